@@ -1,11 +1,17 @@
 import threading
 import time
-from os import path
+import json
+import os
+import tempfile
+from datetime import datetime
+from os import path, makedirs
 import logging
 from .utils import PROJECT_DIR, start_logging_subprocess
-from .exceptions import InvalidClient, ClientTimeout
+from .exceptions import InvalidClient, ClientTimeout, DeadSatellites, \
+    SatelliteBadResponse
 import psutil
 from threading import Thread, Lock
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
 import subprocess
 
 """
@@ -35,6 +41,101 @@ CALIBRATION_TIMEOUT = 60
 NUM_TAGS = 10
 NUM_LOGS = 15
 
+# Maps tracer options which can be passed to `Controller.benchmark` to the
+# client command-line flag which sets them and a function which formats the
+# option's value for that flag. Durations are given in seconds. Only clients
+# in `TRACER_OPTION_CLIENTS` accept these flags.
+TRACER_OPTION_FLAGS = {
+    'ReportingPeriod': ('--reporting_period', lambda s: f'{s}s'),
+    'MinReportingPeriod': ('--min_reporting_period', lambda s: f'{s}s'),
+    'MaxBufferedSpans': ('--max_buffered_spans', lambda n: str(int(n))),
+    'ReportTimeout': ('--report_timeout', lambda s: f'{s}s'),
+    'MaxLogsPerSpan': ('--max_logs_per_span', lambda n: str(int(n))),
+    'DropSpanLogs': ('--drop_span_logs', lambda b: str(int(b))),
+    'Transport': ('--transport', str),
+    'MetaEventReporting': ('--meta_event_reporting', lambda b: str(int(b))),
+    'SystemMetricsDisabled': (
+        '--disable_system_metrics', lambda b: str(int(b))),
+    'SystemMetricsFrequency': (
+        '--system_metrics_frequency', lambda s: f'{s}s'),
+    'Inject': ('--inject', lambda b: str(int(b))),
+    'CallLatency': ('--call_latency', lambda b: str(int(b))),
+    'MetricsPort': ('--metrics_port', lambda n: str(int(n))),
+    'CloseTimeout': ('--close_timeout', lambda s: f'{s}s'),
+    # fault injection on the client's collector connection (gRPC only)
+    'FaultBandwidth': ('--fault_bandwidth', lambda n: str(int(n))),
+    'FaultLatency': ('--fault_latency', lambda s: f'{s}s'),
+    'FaultJitter': ('--fault_jitter', lambda s: f'{s}s'),
+    'FaultStallProbability': ('--fault_stall_probability', str),
+    'FaultStallDuration': ('--fault_stall_duration', lambda s: f'{s}s'),
+    'FaultResetProbability': ('--fault_reset_probability', str),
+    'FaultSeed': ('--fault_seed', lambda n: str(int(n))),
+    # gRPC dial options
+    'GRPCGzip': ('--grpc_gzip', lambda b: str(int(b))),
+    'GRPCInitialWindowSize': (
+        '--grpc_initial_window_size', lambda n: str(int(n))),
+    'GRPCInitialConnWindowSize': (
+        '--grpc_initial_conn_window_size', lambda n: str(int(n))),
+    'GRPCReadBufferSize': ('--grpc_read_buffer_size', lambda n: str(int(n))),
+    'GRPCWriteBufferSize': (
+        '--grpc_write_buffer_size', lambda n: str(int(n))),
+    'GRPCKeepaliveTime': ('--grpc_keepalive_time', lambda s: f'{s}s'),
+    'GRPCKeepaliveTimeout': ('--grpc_keepalive_timeout', lambda s: f'{s}s'),
+    'GRPCKeepalivePermitWithoutStream': (
+        '--grpc_keepalive_permit_without_stream', lambda b: str(int(b))),
+}
+TRACER_OPTION_CLIENTS = {'go', 'go-otel-bridge'}
+
+# Clients which write a JSON line of runtime statistics every second to the
+# file passed with --runtime_stats_file.
+RUNTIME_STATS_CLIENTS = {'go', 'go-otel-bridge'}
+
+# Clients which measure their own CPU and memory use and write the results as
+# JSON, in the format read by `Result.from_dict`, to the file passed with
+# --result_file. Their measurements exclude process startup, so they are used
+# instead of the measurements taken from outside the process.
+SELF_MEASURING_CLIENTS = {'go', 'go-otel-bridge'}
+
+# Clients which accept --ca_cert_file, and so can report to satellites which
+# serve TLS.
+TLS_CLIENTS = {'go', 'go-otel-bridge', 'go-otel'}
+
+# Clients which accept --warmup. When warming up, they print a line of JSON
+# with the MEASUREMENT_STARTED_MARKER key once warmup is over, and the
+# controller only measures the test from then on.
+WARMUP_CLIENTS = {'go', 'go-otel-bridge'}
+MEASUREMENT_STARTED_MARKER = 'MeasurementStarted'
+
+# Clients which print lines of JSON with these keys when they start and finish
+# closing their tracer. The first line has an estimate of the spans the
+# tracer still buffered, if the client can make one, and the second has the
+# time closing took.
+SHUTDOWN_STARTED_MARKER = 'ShutdownStarted'
+SHUTDOWN_FINISHED_MARKER = 'ShutdownFinished'
+
+# Maps the pprof profiles which can be requested from `Controller.benchmark`
+# to the client command-line flag which writes them. Only clients in
+# `PROFILE_CLIENTS` accept these flags.
+PROFILE_FLAGS = {
+    'cpu': '--cpuprofile',
+    'mem': '--memprofile',
+    'mutex': '--mutexprofile',
+    'block': '--blockprofile',
+}
+PROFILE_CLIENTS = {'go', 'go-otel-bridge'}
+
+# Clients which accept --control_url and --control_loop, and so can run many
+# trials in one process by fetching control messages from a `ControlServer`.
+CONTROL_CLIENTS = {'go', 'go-otel-bridge'}
+
+# The keys of a command which are sent to clients as a control message, as
+# described in docs/adding_tracers.md.
+CONTROL_MESSAGE_KEYS = [
+    'Trace', 'Sleep', 'SleepInterval', 'Work', 'Repeat', 'NoFlush']
+
+# profiles are kept with the logs so that CI stores them as artifacts
+PROFILES_DIR = path.join(PROJECT_DIR, 'logs', 'profiles')
+
 
 calibration_work = 200000
 client_args = {
@@ -56,6 +157,12 @@ client_args = {
     'go': [
         path.join(PROJECT_DIR, 'clients/go_client'),
     ],
+    'go-otel-bridge': [
+        path.join(PROJECT_DIR, 'clients/go_client'),
+        '--traceR', 'otel_bridge'],
+    'go-otel': [
+        path.join(PROJECT_DIR, 'clients/otel_client'),
+    ],
     'cpp': [
         path.join(PROJECT_DIR, 'clients/cpp_client'),
     ],
@@ -64,8 +171,56 @@ client_args = {
 logger = logging.getLogger(__name__)
 
 
+def make_temp_file(prefix, suffix):
+    # creates an empty temporary file for the client to write to
+    fd, filename = tempfile.mkstemp(prefix=prefix, suffix=suffix)
+    os.close(fd)
+    return filename
+
+
+def read_self_measurement(filename):
+    # returns the Result written by a self-measuring client, or None if it
+    # didn't write one
+    with open(filename) as result_file:
+        contents = result_file.read()
+    if not contents.strip():
+        return None
+    return Result.from_dict(json.loads(contents))
+
+
+def parse_marker(line):
+    # returns the JSON object printed by a client on a marker line, or None
+    # if the line isn't one
+    if not line.startswith('{'):
+        return None
+    try:
+        marker = json.loads(line)
+    except ValueError:
+        return None
+    return marker if isinstance(marker, dict) else None
+
+
+def read_runtime_stats(filename):
+    # parses the JSON lines written by a client's runtime stats sampler
+    runtime_stats = []
+    with open(filename) as runtime_stats_file:
+        for line in runtime_stats_file:
+            if line.strip():
+                runtime_stats.append(json.loads(line))
+    return runtime_stats
+
+
+def reset_satellites(satellites):
+    # zeroes the satellite counters which are read into a Result
+    satellites.reset_spans_received()
+    satellites.reset_bytes_received()
+    satellites.reset_duplicate_spans()
+    satellites.reset_traces()
+    satellites.reset_delivery_latency()
+
+
 def get_client_args(command):
-    return [
+    args = [
         '--trace', str(int(command['Trace'])),
         '--sleep', str(command['Sleep']),
         '--sleep_interval', str(command['SleepInterval']),
@@ -76,6 +231,34 @@ def get_client_args(command):
         '--num_logs', str(NUM_LOGS),
     ]
 
+    for option, value in command.get('TracerOptions', {}).items():
+        flag, format_value = TRACER_OPTION_FLAGS[option]
+        args += [flag, format_value(value)]
+
+    if command.get('CACertFile'):
+        args += ['--ca_cert_file', command['CACertFile']]
+
+    for profile, filename in command.get('Profiles', {}).items():
+        args += [PROFILE_FLAGS[profile], filename]
+
+    if command.get('Warmup'):
+        args += ['--warmup', f'{command["Warmup"]}s']
+
+    if command.get('ExecutionTrace'):
+        filename, start, duration = command['ExecutionTrace']
+        args += [
+            '--execution_trace', filename,
+            '--execution_trace_start', f'{start}s',
+            '--execution_trace_duration', f'{duration}s']
+
+    if command.get('RuntimeStatsFile'):
+        args += ['--runtime_stats_file', command['RuntimeStatsFile']]
+
+    if command.get('ResultFile'):
+        args += ['--result_file', command['ResultFile']]
+
+    return args
+
 
 class CommandHandle:
     def __init__(self):
@@ -108,6 +291,9 @@ class ClientProcess(subprocess.Popen):
         self._lock = Lock()
         self._cpu_list = []
         self._memory_list = []
+        # CPU and clock time before the measured part of the test started
+        self._start_program_time = 0
+        self._start_clock_time = time.time()
 
         save_list_stats_thread = Thread(
             target=self._save_list_stats,
@@ -145,12 +331,24 @@ class ClientProcess(subprocess.Popen):
                 return self._clock_time
         raise AttributeError()
 
+    def start_measurement(self):
+        # discards the stats collected so far, so that only the part of the
+        # test after the client's warmup is measured
+        with self._lock:
+            self._cpu_list.clear()
+            self._memory_list.clear()
+            # _program_time is measured from the previous start
+            if hasattr(self, '_program_time'):
+                self._start_program_time += self._program_time
+                self._program_time = 0
+                self._clock_time = 0
+            self._start_clock_time = time.time()
+
     def _save_runtime_stats(self):
         # we use a separate resource monitor here because we don't want
         # threading conflicts
         resource_monitor = psutil.Process(pid=self.pid)
         resource_monitor.cpu_percent()  # throw away process CPU usage so far
-        start_clock_time = time.time()
 
         while True:
             time.sleep(.01)
@@ -163,8 +361,9 @@ class ClientProcess(subprocess.Popen):
             try:
                 user, system, _, _ = resource_monitor.cpu_times()
                 with self._lock:
-                    self._program_time = user + system
-                    self._clock_time = time.time() - start_clock_time
+                    self._program_time = \
+                        user + system - self._start_program_time
+                    self._clock_time = time.time() - self._start_clock_time
             # if the child process has shut down, ignore because self.poll()
             # will detect this soon
             except (psutil.AccessDenied, psutil.NoSuchProcess):
@@ -226,6 +425,60 @@ class Result:
     spans_received : int
         Spans received by mock satellites. If the tests was run without mock
         satellites, this is set to 0.
+    bytes_received : int
+        Report payload bytes received by mock satellites, as sent on the wire,
+        so gRPC reports compressed with 'GRPCGzip' count their compressed
+        size. If the tests was run without mock satellites, this is set to 0.
+    duplicate_spans : int
+        Spans received by mock satellites which they had already received,
+        such as spans retried after a failed report. If the tests was run
+        without mock satellites, this is set to 0.
+    traces_received : int
+        Traces with at least one span received by mock satellites. If the
+        tests was run without mock satellites, this is set to 0.
+    complete_traces : int
+        Traces received with their root span and no orphan spans.
+    traces_missing_root : int
+        Traces received without their root span.
+    orphan_spans : int
+        Spans received whose parent span never arrived.
+    incomplete_traces : int
+        Traces received which aren't complete.
+    delivery_latency : dict
+        How long spans took to reach mock satellites after they finished,
+        with keys 'Count', 'Mean', 'Max', 'P50', 'P90', 'P99', 'P99.9' and
+        'Histogram' as returned by `MockSatelliteGroup.get_delivery_latency`.
+        Empty if the test was run without mock satellites.
+    runtime_stats : list of dict
+        Runtime statistics sampled by the client about once a second, with
+        keys 'Time', 'HeapInUse', 'AllocsPerSecond', 'BytesPerSecond',
+        'NumGC', 'GCPauseSeconds', 'NumGoroutine' and 'NumThreads'.
+        Only clients in `RUNTIME_STATS_CLIENTS` report these; for other
+        clients the list is empty.
+    close_time : float
+        Seconds the client took to flush and close its tracer, or None if
+        the client doesn't report it.
+    close_timed_out : bool
+        True if closing the tracer ran past the 'CloseTimeout' tracer option.
+    shutdown_buffered_spans : int
+        An estimate of the spans the tracer still buffered when the client
+        started closing it, or None if the client doesn't report it. The
+        client infers it from the spans its tracer has reported sending and
+        dropping, so it is an upper bound.
+    spans_received_at_shutdown : int
+        Spans received by mock satellites when the client started closing its
+        tracer, or None if it wasn't recorded.
+    shutdown_spans_received : int
+        Spans received by mock satellites after the client started closing
+        its tracer.
+    shutdown_dropped_spans : int
+        Spans buffered at shutdown which mock satellites never received.
+    steady_state_dropped_spans : int
+        Spans dropped before the client started closing its tracer.
+    profiles : dict mapping str to str
+        Paths of the pprof files written by the client, keyed by profile name
+        (eg. 'cpu'). An execution trace is stored under 'trace'. Empty unless
+        profiles or an execution trace were requested.
     memory : int
         Memory use of test just before completion.
     spans_per_second : float
@@ -234,16 +487,32 @@ class Result:
         Fraction of spans which were not received by mock satellites.
     cpu_usage : float
         Average CPU usage over the entire length of the test, from 0.0 to 1.0.
+    bytes_per_span : float
+        Report payload bytes received per span received.
     """
 
     def __init__(self, spans_sent, program_time, clock_time,
-                 memory_list, cpu_list, spans_received=0):
+                 memory_list, cpu_list, spans_received=0, bytes_received=0,
+                 duplicate_spans=0, runtime_stats=None, profiles=None):
         self.spans_sent = spans_sent
         self.program_time = program_time
         self.clock_time = clock_time
         self.memory_list = memory_list
         self.cpu_list = cpu_list
         self.spans_received = spans_received
+        self.bytes_received = bytes_received
+        self.duplicate_spans = duplicate_spans
+        self.traces_received = 0
+        self.complete_traces = 0
+        self.traces_missing_root = 0
+        self.orphan_spans = 0
+        self.delivery_latency = {}
+        self.runtime_stats = runtime_stats or []
+        self.profiles = profiles or {}
+        self.close_time = None
+        self.close_timed_out = False
+        self.shutdown_buffered_spans = None
+        self.spans_received_at_shutdown = None
 
     def __str__(self):
         ret = 'controller.Results object:\n'
@@ -252,6 +521,24 @@ class Result:
         if self.spans_sent > 0:
             ret += (f'\t{self.dropped_spans / self.spans_sent * 100:.1f}' +
                     f'% spans dropped (out of {self.spans_sent} sent)\n')
+        if self.bytes_received > 0:
+            ret += f'\t{self.bytes_per_span:.1f} bytes / span received\n'
+        if self.delivery_latency.get('Count'):
+            ret += (f'\t{self.delivery_latency["P50"]:.3f}s median and ' +
+                    f'{self.delivery_latency["P99"]:.3f}s p99 delivery ' +
+                    'latency\n')
+        if self.incomplete_traces > 0:
+            ret += (f'\t{self.incomplete_traces} of ' +
+                    f'{self.traces_received} traces received incomplete\n')
+        if self.duplicate_spans > 0:
+            ret += f'\t{self.duplicate_spans} duplicate spans received\n'
+        if self.close_time is not None:
+            ret += f'\tclosing the tracer took {self.close_time:.3f}s'
+            ret += ' (timed out)\n' if self.close_timed_out else '\n'
+        if self.shutdown_dropped_spans is not None:
+            ret += (f'\t{self.shutdown_dropped_spans} of ' +
+                    f'~{self.shutdown_buffered_spans} spans buffered at ' +
+                    'shutdown dropped\n')
         ret += f'\ttook {self.clock_time:.1f}s'
 
         return ret
@@ -291,6 +578,132 @@ class Result:
     def cpu_usage(self):
         return self.program_time / self.clock_time
 
+    @property
+    def incomplete_traces(self):
+        return self.traces_received - self.complete_traces
+
+    @property
+    def shutdown_spans_received(self):
+        if self.spans_received_at_shutdown is None:
+            return None
+        return self.spans_received - self.spans_received_at_shutdown
+
+    @property
+    def shutdown_dropped_spans(self):
+        if self.shutdown_buffered_spans is None or \
+                self.shutdown_spans_received is None:
+            return None
+        return max(
+            self.shutdown_buffered_spans - self.shutdown_spans_received, 0)
+
+    @property
+    def steady_state_dropped_spans(self):
+        if self.shutdown_dropped_spans is None:
+            return None
+        return self.dropped_spans - self.shutdown_dropped_spans
+
+    @property
+    def bytes_per_span(self):
+        if self.spans_received == 0:
+            return 0
+        return self.bytes_received / self.spans_received
+
+
+class ControlServer:
+    """
+    Serves control messages to clients started with --control_url, as
+    described in docs/adding_tracers.md, and collects the results they POST
+    back to /result.
+
+    Each GET of /control hands out the next command, or responds with 204 No
+    Content once there are none left. If satellites are given, they are reset
+    before each command is handed out and read when its result is posted, so
+    each result counts the spans received during its own trial.
+    """
+
+    def __init__(self, commands, satellites=None, port=CONTROLLER_PORT):
+        self._lock = Lock()
+        self._commands = list(commands)
+        self._satellites = satellites
+        self._results = []
+
+        server = self
+
+        class Handler(BaseHTTPRequestHandler):
+            def do_GET(self):
+                if self.path != '/control':
+                    self.send_error(404)
+                    return
+                message = server._next_message()
+                if message is None:
+                    self.send_response(204)
+                    self.end_headers()
+                    return
+                body = json.dumps(message).encode()
+                self.send_response(200)
+                self.send_header('Content-Type', 'application/json')
+                self.send_header('Content-Length', str(len(body)))
+                self.end_headers()
+                self.wfile.write(body)
+
+            def do_POST(self):
+                if self.path != '/result':
+                    self.send_error(404)
+                    return
+                length = int(self.headers.get('Content-Length', 0))
+                try:
+                    result_dict = json.loads(self.rfile.read(length))
+                except ValueError:
+                    self.send_error(400)
+                    return
+                server._add_result(result_dict)
+                self.send_response(200)
+                self.end_headers()
+
+            def log_message(self, format, *args):
+                logger.debug('control server: ' + format, *args)
+
+        self._server = ThreadingHTTPServer(('localhost', port), Handler)
+        self._thread = Thread(target=self._server.serve_forever)
+        self._thread.daemon = True
+        self._thread.start()
+        logger.info(f'Started control server on port {port}.')
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, type, value, traceback):
+        self.shutdown()
+        return False
+
+    @property
+    def results(self):
+        """ The results posted so far, as a list of `Result`. """
+        with self._lock:
+            return self._results.copy()
+
+    def _next_message(self):
+        with self._lock:
+            if not self._commands:
+                return None
+            command = self._commands.pop(0)
+            if self._satellites:
+                reset_satellites(self._satellites)
+            return {key: command[key] for key in CONTROL_MESSAGE_KEYS}
+
+    def _add_result(self, result_dict):
+        with self._lock:
+            spans_received = 0
+            if self._satellites:
+                spans_received = self._satellites.get_spans_received()
+            self._results.append(
+                Result.from_dict(result_dict, spans_received=spans_received))
+
+    def shutdown(self):
+        """ Stop serving control messages. """
+        self._server.shutdown()
+        self._server.server_close()
+
 
 class Controller:
     """ Harness used to benchmark tracers. """
@@ -437,7 +850,11 @@ class Controller:
             no_flush=False,
             spans_per_second=100,
             runtime=10,
-            no_timeout=False):
+            no_timeout=False,
+            tracer_options=None,
+            profiles=None,
+            execution_trace=None,
+            warmup=0):
         """
         Run a test using the client this Controller is bound to.
 
@@ -446,7 +863,9 @@ class Controller:
         satellites : satellite.MockSatelliteGroup
             Group of satellites that client program should send data to.
             If not specified, returned `Result` object won't have accurate
-            `dropped_spans` or `spans_received` attributes.
+            `dropped_spans` or `spans_received` attributes. If the group
+            serves TLS, the client is told to report over TLS, which only
+            clients in `TLS_CLIENTS` support.
         trace : bool
             False if the client should use a NoOp tracer.
         no_flush : bool
@@ -460,6 +879,31 @@ class Controller:
         no_timeout : bool
             If True, the test has no maximum duration. If False, the tests will
             be stopped after `runtime` * 2 seconds.
+        tracer_options : dict, optional
+            Tracer configuration passed through to the client, keyed by option
+            name (eg. 'ReportingPeriod', 'MaxBufferedSpans', 'Transport'). See
+            `TRACER_OPTION_FLAGS` for the supported options. Durations are in
+            seconds. Only clients in `TRACER_OPTION_CLIENTS` accept these
+            options.
+        profiles : list of str, optional
+            pprof profiles the client should write for the test (eg. 'cpu',
+            'mem'). See `PROFILE_FLAGS` for the supported profiles. Profiles
+            are written to logs/profiles and their paths are stored in
+            `Result.profiles`. Only clients in `PROFILE_CLIENTS` support
+            profiling.
+        execution_trace : tuple of float, optional
+            A (start, duration) window, in seconds after the client starts
+            generating spans, for which the client records a Go execution
+            trace. A duration of 0 records until the client exits. The trace
+            is written to logs/profiles and its path is stored in
+            `Result.profiles['trace']`. Only clients in `PROFILE_CLIENTS`
+            support execution traces.
+        warmup : float
+            Seconds for which the client generates spans before the test is
+            measured. Spans, CPU use, memory use and satellite span counts
+            from the warmup are not included in the result. The test runs for
+            about `warmup` + `runtime` seconds. Only clients in
+            `WARMUP_CLIENTS` support warmup.
 
         Returns
         -------
@@ -469,7 +913,13 @@ class Controller:
         Raises
         ------
         ValueError
-            If `spans_per_second` is set to 0.
+            If `spans_per_second` is set to 0, `tracer_options` contains an
+            unknown option or is passed to a client which doesn't accept
+            tracer options, `profiles` contains an unknown profile, or
+            `profiles` or `execution_trace` is passed to a client which
+            doesn't support profiling, `warmup` is passed to a client which
+            doesn't support warmup, or `satellites` serve TLS to a client
+            which doesn't support it.
         """
 
         logger.info((
@@ -481,6 +931,32 @@ class Controller:
         if spans_per_second == 0:
             raise ValueError("Cannot target 0 spans per second.")
 
+        tracer_options = tracer_options or {}
+        for option in tracer_options:
+            if option not in TRACER_OPTION_FLAGS:
+                raise ValueError(f'Unknown tracer option {option}.')
+        if tracer_options and self.client_name not in TRACER_OPTION_CLIENTS:
+            raise ValueError(
+                f'Client {self.client_name} does not accept tracer options.')
+
+        profiles = profiles or []
+        for profile in profiles:
+            if profile not in PROFILE_FLAGS:
+                raise ValueError(f'Unknown profile {profile}.')
+        if (profiles or execution_trace) and \
+                self.client_name not in PROFILE_CLIENTS:
+            raise ValueError(
+                f'Client {self.client_name} does not support profiling.')
+
+        if warmup and self.client_name not in WARMUP_CLIENTS:
+            raise ValueError(
+                f'Client {self.client_name} does not support warmup.')
+
+        if satellites and satellites.ca_cert_file and \
+                self.client_name not in TLS_CLIENTS:
+            raise ValueError(
+                f'Client {self.client_name} does not support TLS.')
+
         if runtime < 1:
             logger.warn("Test `runtime` should be longer than 1 second.")
 
@@ -489,14 +965,25 @@ class Controller:
 
         # set command server timeout relative to target runtime
         if not no_timeout:
-            self.command_handle.timeout = runtime * 2
+            self.command_handle.timeout = runtime * 2 + warmup
         else:
             self.command_handle.timeout = None
 
         # make sure that satellite span counters are all zeroed
         # throws an error if the satellites aren't running
         if satellites:
-            satellites.reset_spans_received()
+            reset_satellites(satellites)
+            # validation is read after the test, so it's only reset before.
+            # Spans from earlier tests aren't resent, so the satellites can
+            # forget them.
+            satellites.reset_validation()
+            satellites.reset_duplicate_detection()
+
+        profile_files = self._profile_files(profiles, bool(execution_trace))
+        execution_trace_command = None
+        if execution_trace:
+            execution_trace_command = \
+                (profile_files['trace'], *execution_trace)
 
         result = self._raw_benchmark({
             'Trace': trace,
@@ -504,32 +991,215 @@ class Controller:
             'SleepInterval': DEFAULT_SLEEP_INTERVAL,
             'Work': int(work),
             'Repeat': int(repeat),
-            'NoFlush': no_flush
-        })
+            'NoFlush': no_flush,
+            'TracerOptions': tracer_options,
+            # clients report over TLS when the satellites serve it
+            'CACertFile': satellites.ca_cert_file if satellites else None,
+            'Profiles': {
+                profile: filename
+                for profile, filename in profile_files.items()
+                if profile in PROFILE_FLAGS},
+            'ExecutionTrace': execution_trace_command,
+            'Warmup': warmup
+        }, satellites=satellites)
+        result.profiles = {
+            profile: filename
+            for profile, filename in profile_files.items()
+            if path.exists(filename)}
 
         # give the satellites 1s to handle the spans
         if satellites:
             time.sleep(1)
             result.spans_received = satellites.get_spans_received()
-            satellites.reset_spans_received()
+            result.bytes_received = satellites.get_bytes_received()
+            result.duplicate_spans = satellites.get_duplicate_spans()
+            traces = satellites.get_trace_summary()
+            result.traces_received = traces['Traces']
+            result.complete_traces = traces['CompleteTraces']
+            result.traces_missing_root = traces['TracesMissingRoot']
+            result.orphan_spans = traces['OrphanSpans']
+            result.delivery_latency = satellites.get_delivery_latency()
+            reset_satellites(satellites)
 
         return result
 
-    def _raw_benchmark(self, command):
+    def benchmark_trials(
+            self,
+            trials,
+            satellites=None,
+            trace=True,
+            no_flush=False,
+            spans_per_second=100,
+            runtime=10,
+            no_timeout=False):
+        """
+        Run the same test `trials` times in a single client process, which
+        fetches each test from a `ControlServer`. Trials after the first don't
+        pay for starting the client, so this measures a warm client.
+
+        Parameters are as for `benchmark`.
+
+        Returns
+        -------
+        list of controller.Result
+            The results the client posted for each trial. `spans_received` is
+            the spans the satellites received during the trial.
+
+        Raises
+        ------
+        ValueError
+            If `spans_per_second` is set to 0, the client isn't in
+            `CONTROL_CLIENTS`, or `satellites` serve TLS to a client which
+            doesn't support it.
+        ClientTimeout
+            If the client runs for more than `runtime` * 2 seconds per trial
+            and `no_timeout` is False.
+        """
+
+        if spans_per_second == 0:
+            raise ValueError("Cannot target 0 spans per second.")
+        if self.client_name not in CONTROL_CLIENTS:
+            raise ValueError(
+                f'Client {self.client_name} does not accept control messages.')
+        if satellites and satellites.ca_cert_file and \
+                self.client_name not in TLS_CLIENTS:
+            raise ValueError(
+                f'Client {self.client_name} does not support TLS.')
+
+        work = self._work_per_second / spans_per_second
+        repeat = self._work_per_second * runtime / work
+        command = {
+            'Trace': trace,
+            'Sleep': int(work * self._sleep_per_work),
+            'SleepInterval': DEFAULT_SLEEP_INTERVAL,
+            'Work': int(work),
+            'Repeat': int(repeat),
+            'NoFlush': no_flush,
+        }
+        args = [
+            '--control_url', f'http://localhost:{CONTROLLER_PORT}/control',
+            '--control_loop', '1',
+            '--num_tags', str(NUM_TAGS),
+            '--num_logs', str(NUM_LOGS),
+        ]
+        if satellites and satellites.ca_cert_file:
+            args += ['--ca_cert_file', satellites.ca_cert_file]
+
+        if satellites:
+            satellites.reset_validation()
+            satellites.reset_duplicate_detection()
+
+        client_logger = logging.getLogger(
+            f'{__name__}.{self.client_name}_client')
+        with ControlServer([command] * trials, satellites) as server:
+            client_handle = start_logging_subprocess(
+                self.client_startup_args + args, client_logger)
+            timeout = None if no_timeout else runtime * 2 * trials
+            try:
+                client_handle.wait(timeout)
+            except subprocess.TimeoutExpired:
+                client_handle.kill()
+                self.command_handle.handle_timeout()
+            results = server.results
+
+        if satellites:
+            reset_satellites(satellites)
+        return results
+
+    def _profile_files(self, profiles, execution_trace=False):
+        # names a file in PROFILES_DIR for each requested profile and for the
+        # execution trace
+        if not profiles and not execution_trace:
+            return {}
+
+        makedirs(PROFILES_DIR, exist_ok=True)
+        timestamp = datetime.now().strftime('%Y%m%d-%H%M%S-%f')
+        prefix = path.join(PROFILES_DIR, f'{self.client_name}_{timestamp}')
+        files = {profile: f'{prefix}_{profile}.pprof' for profile in profiles}
+        if execution_trace:
+            files['trace'] = f'{prefix}_execution.trace'
+        return files
+
+    def _raw_benchmark(self, command, satellites=None):
         logger.info("Starting client...")
 
+        shutdown = {}
+
+        def handle_marker(client_handle, line):
+            marker = parse_marker(line)
+            if marker is None:
+                return
+
+            # restarts measurement once the client's warmup is over. Without
+            # a warmup, the whole test is measured and satellites must not be
+            # reset after the client has started reporting.
+            if MEASUREMENT_STARTED_MARKER in marker and command.get('Warmup'):
+                logger.info("Client started measuring.")
+                client_handle.start_measurement()
+                if satellites:
+                    reset_satellites(satellites)
+
+            # records what the satellites had received before shutdown, so
+            # spans lost at shutdown can be told apart from other drops
+            if SHUTDOWN_STARTED_MARKER in marker:
+                logger.info("Client started closing its tracer.")
+                shutdown['shutdown_buffered_spans'] = \
+                    marker.get('EstimatedBufferedSpans')
+                if satellites:
+                    try:
+                        shutdown['spans_received_at_shutdown'] = \
+                            satellites.get_spans_received()
+                    except (DeadSatellites, SatelliteBadResponse):
+                        logger.warning(
+                            'Unable to count spans received at shutdown.')
+
+            if SHUTDOWN_FINISHED_MARKER in marker:
+                shutdown['close_time'] = marker.get('CloseTime')
+                shutdown['close_timed_out'] = \
+                    marker.get('CloseTimedOut', False)
+
         client_logger = logging.getLogger(
             f'{__name__}.{self.client_name}_client')
 
-        client_handle = start_logging_subprocess(
-            self.client_startup_args + get_client_args(command),
-            client_logger,
-            popen_class=ClientProcess)
+        runtime_stats_file = None
+        if self.client_name in RUNTIME_STATS_CLIENTS:
+            runtime_stats_file = make_temp_file('runtime_stats_', '.jsonl')
+            command = dict(command, RuntimeStatsFile=runtime_stats_file)
+
+        result_file = None
+        if self.client_name in SELF_MEASURING_CLIENTS:
+            result_file = make_temp_file('result_', '.json')
+            command = dict(command, ResultFile=result_file)
 
-        logger.info("Client test started.")
-        results = self.command_handle.run_test(command, client_handle)
-        logger.info("Client test stopped.")
+        try:
+            client_handle = start_logging_subprocess(
+                self.client_startup_args + get_client_args(command),
+                client_logger,
+                popen_class=ClientProcess,
+                stdout_filter=handle_marker)
+
+            logger.info("Client test started.")
+            results = self.command_handle.run_test(command, client_handle)
+            logger.info("Client test stopped.")
+
+            if result_file:
+                self_measurement = read_self_measurement(result_file)
+                if self_measurement:
+                    results = self_measurement
+                else:
+                    logger.warning(
+                        'Client did not write its results, using ' +
+                        'measurements taken from outside the client.')
+
+            if runtime_stats_file:
+                results.runtime_stats = read_runtime_stats(runtime_stats_file)
+        finally:
+            for filename in [runtime_stats_file, result_file]:
+                if filename:
+                    os.remove(filename)
 
         results.spans_sent = int(command['Repeat'])
+        for attribute, value in shutdown.items():
+            setattr(results, attribute, value)
 
         return results
@@ -1,9 +1,14 @@
 import generated.collector_pb2 as collector
+import generated.otlp_trace_pb2 as otlp
 import google.protobuf
 from http.server import ThreadingHTTPServer
 from utils import ChunkedRequestHandler
 import threading
 import argparse
+import hashlib
+import json
+import math
+import ssl
 import time
 import logging
 import sys
@@ -17,13 +22,48 @@ logging.basicConfig(
     level=logging.DEBUG,
     handlers=[logging.StreamHandler(sys.stdout)])
 
-# multiple threads may access spans_received so it's protected with a lock
+# multiple threads may access these counters so they're protected with a lock
 spans_received = 0
+bytes_received = 0
+meta_events_received = 0
+metrics_requests_received = 0
+duplicate_spans = 0
 global_lock = threading.Lock()
 
+# tracers tag the spans they report for meta events with this key
+META_EVENT_KEY = 'lightstep.meta_event'
+
 # fine to have this global w/o locks its not mutable
 MODE = None
 
+# validates received spans when the satellite is started with --validate
+VALIDATOR = None
+
+# clients set tags keyed tag.key0 to tag.key<num_tags - 1> on each span
+WORKLOAD_TAG_PREFIX = 'tag.key'
+
+# the number of problems described in the validation report
+MAX_VALIDATION_EXAMPLES = 10
+
+# remembers the spans received to count duplicates, unless the satellite is
+# started with --duplicate_detection off
+SPAN_SET = None
+
+# rebuilds the traces received since the last reset
+TRACES = None
+
+# how long spans took to reach the satellite after they finished
+DELIVERY_LATENCY = None
+
+# delivery latencies are counted in buckets which split each doubling of
+# microseconds 16 ways, the same buckets as the Go mock satellite's
+DELIVERY_BUCKETS_PER_DOUBLING = 16
+
+# with 16 bits per span and 11 hash functions, a bloom filter filled to
+# capacity mistakes about 0.05% of new spans for duplicates
+BLOOM_BITS_PER_SPAN = 16
+BLOOM_HASHES = 11
+
 # all in microseconds:
 
 SPAN_NORMALIZER = 10000.0
@@ -32,6 +72,324 @@ SLOW_RESPONSE_TIME = 10000 / SPAN_NORMALIZER
 FAST_RESPONSE_TIME = 100 / SPAN_NORMALIZER
 
 
+def count_lightstep_spans(report_request):
+    # meta event spans are reported alongside the spans the client generated,
+    # so they're counted separately to keep spans_received comparable
+    meta_events = sum(
+        1 for span in report_request.spans
+        if any(tag.key == META_EVENT_KEY for tag in span.tags))
+    return len(report_request.spans) - meta_events, meta_events
+
+
+def lightstep_span_ids(report_request):
+    # yields the trace ID, span ID and parent span ID of each span as bytes,
+    # skipping meta event spans like spans_received does; root spans have an
+    # empty parent ID
+    for span in report_request.spans:
+        if any(tag.key == META_EVENT_KEY for tag in span.tags):
+            continue
+        parent = b''
+        if span.references and span.references[0].span_context.span_id:
+            parent = span.references[0].span_context.span_id.to_bytes(
+                8, 'big')
+        yield (span.span_context.trace_id.to_bytes(8, 'big'),
+               span.span_context.span_id.to_bytes(8, 'big'),
+               parent)
+
+
+def otlp_span_ids(export_request):
+    for resource_spans in export_request.resource_spans:
+        for scope_spans in resource_spans.scope_spans:
+            for span in scope_spans.spans:
+                yield span.trace_id, span.span_id, span.parent_span_id
+
+
+def lightstep_finish_times(report_request):
+    for span in report_request.spans:
+        if not any(tag.key == META_EVENT_KEY for tag in span.tags):
+            yield span.start_timestamp.seconds + \
+                span.start_timestamp.nanos / 1e9 + \
+                span.duration_micros / 1e6
+
+
+def otlp_finish_times(export_request):
+    for resource_spans in export_request.resource_spans:
+        for scope_spans in resource_spans.scope_spans:
+            for span in scope_spans.spans:
+                yield span.end_time_unix_nano / 1e9
+
+
+class DeliveryLatency:
+    """ Records how long each span took to reach the satellite after it
+    finished, since the last reset. Clients run on the same host, so their
+    clocks are the satellite's. """
+
+    PERCENTILES = [('P50', 50), ('P90', 90), ('P99', 99), ('P99.9', 99.9)]
+
+    def __init__(self):
+        self.reset()
+
+    def reset(self):
+        self._counts = {}
+        self._count = 0
+        self._sum = 0
+        self._max = 0
+
+    def record(self, latency):
+        # spans which seem to have finished after they were received, because
+        # their duration was rounded up, are counted as delivered instantly
+        latency = max(latency, 0)
+        micros = latency * 1e6
+        bucket = 0
+        if micros > 1:
+            bucket = math.ceil(
+                math.log2(micros) * DELIVERY_BUCKETS_PER_DOUBLING)
+        self._counts[bucket] = self._counts.get(bucket, 0) + 1
+        self._count += 1
+        self._sum += latency
+        self._max = max(self._max, latency)
+
+    def summary(self):
+        # the histogram lists the upper bound and count of each non-empty
+        # bucket, in seconds
+        histogram = [
+            [2 ** (bucket / DELIVERY_BUCKETS_PER_DOUBLING) / 1e6,
+             self._counts[bucket]]
+            for bucket in sorted(self._counts)]
+        summary = {
+            'Count': self._count,
+            'Max': self._max,
+            'Mean': self._sum / self._count if self._count else 0,
+            'Histogram': histogram,
+        }
+        for name, percent in self.PERCENTILES:
+            summary[name] = histogram_percentile(
+                histogram, percent, self._count, self._max)
+        return summary
+
+
+def histogram_percentile(histogram, percent, count, max_latency):
+    """ Returns the upper bound of the histogram bucket holding the percentile,
+    capped at the largest latency recorded. """
+    rank = math.ceil(percent / 100 * count)
+    seen = 0
+    for bound, bucket_count in histogram:
+        seen += bucket_count
+        if seen >= rank:
+            return min(bound, max_latency)
+    return max_latency
+
+
+class TraceAssembler:
+    """ Rebuilds the traces received since the last reset from the spans'
+    contexts and references, like the Go mock satellite does. """
+
+    def __init__(self, spans_per_trace):
+        self._spans_per_trace = spans_per_trace
+        # maps each span of each trace to its parent, or to b'' if it's a
+        # root span
+        self._traces = {}
+        # the traces received before the last reset; spans of these traces
+        # received since are ignored, since their trace would be missing the
+        # spans received before the reset
+        self._excluded = set()
+
+    def add(self, trace_id, span_id, parent_id):
+        if trace_id in self._excluded:
+            return
+        self._traces.setdefault(trace_id, {})[span_id] = parent_id
+
+    def summary(self):
+        summary = {
+            'Traces': len(self._traces),
+            'CompleteTraces': 0,
+            'TracesMissingRoot': 0,
+            'OrphanSpans': 0,
+        }
+        for spans in self._traces.values():
+            has_root = b'' in spans.values()
+            # orphan spans are spans whose parent never arrived
+            orphans = sum(1 for parent in spans.values()
+                          if parent and parent not in spans)
+            if not has_root:
+                summary['TracesMissingRoot'] += 1
+            summary['OrphanSpans'] += orphans
+            if has_root and not orphans and (
+                    not self._spans_per_trace or
+                    len(spans) == self._spans_per_trace):
+                summary['CompleteTraces'] += 1
+        return summary
+
+    def reset(self):
+        self._excluded = set(self._traces)
+        self._traces = {}
+
+
+class ExactSpanSet:
+    def __init__(self):
+        self._keys = set()
+
+    def add(self, key):
+        """ Adds a span key, returning True if it was added before. """
+        if key in self._keys:
+            return True
+        self._keys.add(key)
+        return False
+
+    def clear(self):
+        """ Forgets every key, freeing the memory they took. """
+        self._keys = set()
+
+
+class BloomFilter:
+    """ A compact span set which may mistake new keys for ones it has seen,
+    but never the other way around. """
+
+    def __init__(self, capacity):
+        self._size = capacity * BLOOM_BITS_PER_SPAN
+        self._bits = bytearray((self._size + 7) // 8)
+
+    def add(self, key):
+        """ Adds a span key, returning True if it was probably added
+        before. """
+        digest = hashlib.blake2b(key, digest_size=16).digest()
+        h1 = int.from_bytes(digest[:8], 'big')
+        h2 = int.from_bytes(digest[8:], 'big') | 1
+        seen = True
+        for i in range(BLOOM_HASHES):
+            bit = (h1 + i * h2) % self._size
+            mask = 1 << (bit % 8)
+            if not self._bits[bit // 8] & mask:
+                seen = False
+                self._bits[bit // 8] |= mask
+        return seen
+
+    def clear(self):
+        """ Forgets every key. """
+        self._bits = bytearray(len(self._bits))
+
+
+def format_lightstep_id(id):
+    return format(id, 'x') if id else ''
+
+
+class Validator:
+    """ Checks received spans against the workload's expectations, like the Go
+    mock satellite does. """
+
+    PROBLEMS = ['OperationName', 'TagCount', 'TagKeys', 'LogCount',
+                'Duration', 'References']
+
+    def __init__(self, num_tags, num_logs, operation_name):
+        self._num_tags = num_tags
+        self._num_logs = num_logs
+        self._operation_name = operation_name
+        self._lock = threading.Lock()
+        self.reset()
+
+    def reset(self):
+        """ Forgets the spans validated so far, including the root span of
+        each trace. """
+        with self._lock:
+            self._spans_validated = 0
+            self._invalid_spans = 0
+            self._problems = {problem: 0 for problem in self.PROBLEMS}
+            self._examples = []
+            # maps each trace to its root span; child spans whose references
+            # were lost show up as a second root in their trace
+            self._roots = {}
+
+    def validate_lightstep_report(self, report_request):
+        for span in report_request.spans:
+            keys = [tag.key for tag in span.tags]
+            # meta event spans aren't part of the workload
+            if META_EVENT_KEY in keys:
+                continue
+            parent = None
+            if span.references:
+                parent = span.references[0].span_context
+            self._validate(
+                trace_id=format_lightstep_id(span.span_context.trace_id),
+                span_id=format_lightstep_id(span.span_context.span_id),
+                has_parent=parent is not None,
+                # LightStep tracers leave out the trace of references within
+                # the trace
+                parent_trace_id=format_lightstep_id(parent.trace_id)
+                if parent else '',
+                parent_span_id=format_lightstep_id(parent.span_id)
+                if parent else '',
+                operation_name=span.operation_name,
+                duration=span.duration_micros,
+                tag_keys=keys,
+                logs=len(span.logs))
+
+    def validate_otlp_export(self, export_request):
+        for resource_spans in export_request.resource_spans:
+            for scope_spans in resource_spans.scope_spans:
+                for span in scope_spans.spans:
+                    # OTLP parents are always in the span's trace
+                    self._validate(
+                        trace_id=span.trace_id.hex(),
+                        span_id=span.span_id.hex(),
+                        has_parent=bool(span.parent_span_id),
+                        parent_trace_id='',
+                        parent_span_id=span.parent_span_id.hex(),
+                        operation_name=span.name,
+                        duration=span.end_time_unix_nano -
+                        span.start_time_unix_nano,
+                        tag_keys=[a.key for a in span.attributes],
+                        logs=len(span.events))
+
+    def _validate(self, trace_id, span_id, has_parent, parent_trace_id,
+                  parent_span_id, operation_name, duration, tag_keys, logs):
+        found = []
+
+        if self._operation_name and operation_name != self._operation_name:
+            found.append(('OperationName', f'operation name {operation_name}'))
+        elif not operation_name:
+            found.append(('OperationName', 'no operation name'))
+        workload_keys = [key for key in tag_keys
+                         if key.startswith(WORKLOAD_TAG_PREFIX)]
+        if len(workload_keys) != self._num_tags:
+            found.append(('TagCount', f'{len(workload_keys)} tags'))
+        missing = [WORKLOAD_TAG_PREFIX + str(i) for i in range(self._num_tags)
+                   if WORKLOAD_TAG_PREFIX + str(i) not in workload_keys]
+        if missing:
+            found.append(('TagKeys', 'missing tags ' + ', '.join(missing)))
+        if logs != self._num_logs:
+            found.append(('LogCount', f'{logs} logs'))
+        if duration <= 0:
+            found.append(('Duration', 'zero duration'))
+        if has_parent and (not parent_span_id or parent_span_id == span_id or
+                           parent_trace_id not in ('', trace_id)):
+            found.append(('References', 'invalid reference'))
+
+        with self._lock:
+            if not has_parent:
+                root = self._roots.setdefault(trace_id, span_id)
+                if root != span_id:
+                    found.append(('References', 'second root span in trace'))
+            self._spans_validated += 1
+            if not found:
+                return
+            self._invalid_spans += 1
+            for problem, _ in found:
+                self._problems[problem] += 1
+            if len(self._examples) < MAX_VALIDATION_EXAMPLES:
+                self._examples.append(f'span {span_id}: ' +
+                                      '; '.join(d for _, d in found))
+
+    def report(self):
+        with self._lock:
+            return {
+                'Enabled': True,
+                'SpansValidated': self._spans_validated,
+                'InvalidSpans': self._invalid_spans,
+                'Problems': dict(self._problems),
+                'Examples': list(self._examples),
+            }
+
+
 class SatelliteRequestHandler(ChunkedRequestHandler):
     def _send_response(self, response_code, body_string=None):
         self.send_response(response_code)
@@ -58,52 +416,152 @@ class SatelliteRequestHandler(ChunkedRequestHandler):
 
             self._send_response(200, body_string=str(spans_received))
             return
+        elif self.path == "/spans_received_by_transport":
+            # this satellite only serves HTTP, so every span arrives over it
+            self._send_response(200, body_string=json.dumps(
+                {'http': spans_received, 'grpc': 0}))
+        elif self.path == "/traces":
+            with global_lock:
+                summary = TRACES.summary()
+            self._send_response(200, body_string=json.dumps(summary))
+        elif self.path == "/delivery_latency":
+            with global_lock:
+                summary = DELIVERY_LATENCY.summary()
+            self._send_response(200, body_string=json.dumps(summary))
+        elif self.path == "/duplicate_spans":
+            self._send_response(200, body_string=str(duplicate_spans))
+        elif self.path == "/validation":
+            report = VALIDATOR.report() if VALIDATOR else {'Enabled': False}
+            self._send_response(200, body_string=json.dumps(report))
+        elif self.path == "/bytes_received":
+            self._send_response(200, body_string=str(bytes_received))
+        elif self.path == "/meta_events_received":
+            self._send_response(200, body_string=str(meta_events_received))
+        elif self.path == "/metrics_requests_received":
+            self._send_response(
+                200, body_string=str(metrics_requests_received))
         else:
             self._send_response(400)
 
     def POST(self):
         if self.path == "/api/v2/reports":
-            global MODE
+            report_request = collector.ReportRequest()
+            self._handle_report(
+                report_request,
+                lambda: count_lightstep_spans(report_request),
+                collector.ReportResponse(),
+                lambda: VALIDATOR.validate_lightstep_report(report_request),
+                lambda: lightstep_span_ids(report_request),
+                lambda: lightstep_finish_times(report_request))
+        elif self.path == "/v1/traces":
+            # OTLP/HTTP exports from OpenTelemetry clients are handled
+            # exactly like LightStep reports
+            export_request = otlp.ExportTraceServiceRequest()
+            self._handle_report(
+                export_request,
+                lambda: (sum(
+                    len(scope_spans.spans)
+                    for resource_spans in export_request.resource_spans
+                    for scope_spans in resource_spans.scope_spans), 0),
+                otlp.ExportTraceServiceResponse(),
+                lambda: VALIDATOR.validate_otlp_export(export_request),
+                lambda: otlp_span_ids(export_request),
+                lambda: otlp_finish_times(export_request))
+        elif self.path == "/delivery_latency/reset":
+            with global_lock:
+                DELIVERY_LATENCY.reset()
+            self._send_response(200)
+        elif self.path == "/traces/reset":
+            with global_lock:
+                TRACES.reset()
+            self._send_response(200)
+        elif self.path == "/duplicate_spans/reset":
+            # the exact span set grows with every span received, so it's
+            # reset between tests to bound the satellite's memory
+            global duplicate_spans
+            with global_lock:
+                if SPAN_SET is not None:
+                    SPAN_SET.clear()
+                duplicate_spans = 0
+            self._send_response(200)
+        elif self.path == "/validation/reset":
+            if VALIDATOR:
+                VALIDATOR.reset()
+            self._send_response(200)
+        elif self.path == "/metrics":
+            # system metrics ingest requests are accepted but not decoded
+            global metrics_requests_received
+            with global_lock:
+                metrics_requests_received += 1
+            self._send_response(200)
+        else:
+            self._send_response(400)
 
-            logging.info("Processing report request in {} mode.".format(MODE))
+    def _handle_report(self, request, count_spans, response, validate,
+                       span_ids, finish_times):
+        # count_spans returns the number of spans and the number of meta event
+        # spans in the parsed request, validate checks its spans when
+        # validation is enabled, span_ids yields the trace, span and parent
+        # IDs of each of its spans and finish_times yields the time each of
+        # its spans finished
+        global MODE
+        global duplicate_spans
 
-            report_request = collector.ReportRequest()
+        received = time.time()
+
+        logging.info("Processing report request in {} mode.".format(MODE))
 
-            try:
-                report_request.ParseFromString(self.binary_body)
-                spans_in_report = len(report_request.spans)
-                if MODE == 'typical':
-                    time.sleep(
-                        (TYPICAL_RESPONSE_TIME*spans_in_report) * 10**-6)
-                if MODE == 'slow_succeed':
-                    time.sleep((SLOW_RESPONSE_TIME*spans_in_report) * 10**-6)
-                if MODE == 'slow_fail':
-                    time.sleep((FAST_RESPONSE_TIME*spans_in_report) * 10**-6)
-                    self._send_response(400)
-                    return
-            except google.protobuf.message.DecodeError as e:
-                # when satellites are unable to parse the report_request, they
-                # send a 500 with a brief description
-                self._send_response(500, str(e))
+        try:
+            request.ParseFromString(self.binary_body)
+            spans_in_report, meta_events_in_report = count_spans()
+            # spans in reports which fail are remembered too, so that
+            # retries are counted as duplicates
+            if SPAN_SET is not None:
+                with global_lock:
+                    duplicate_spans += sum(
+                        1 for trace_id, span_id, _ in span_ids()
+                        if SPAN_SET.add(trace_id + span_id))
+            if MODE == 'typical':
+                time.sleep(
+                    (TYPICAL_RESPONSE_TIME*spans_in_report) * 10**-6)
+            if MODE == 'slow_succeed':
+                time.sleep((SLOW_RESPONSE_TIME*spans_in_report) * 10**-6)
+            if MODE == 'slow_fail':
+                time.sleep((FAST_RESPONSE_TIME*spans_in_report) * 10**-6)
+                self._send_response(400)
                 return
+        except google.protobuf.message.DecodeError as e:
+            # when satellites are unable to parse the report_request, they
+            # send a 500 with a brief description
+            self._send_response(500, str(e))
+            return
 
-            global spans_received
+        global spans_received
+        global bytes_received
+        global meta_events_received
 
-            # aquire the global variable lock because we are using a
-            # "multithreaded" server
-            with global_lock:
-                spans_received += spans_in_report
+        # aquire the global variable lock because we are using a
+        # "multithreaded" server
+        with global_lock:
+            spans_received += spans_in_report
+            bytes_received += len(self.binary_body)
+            meta_events_received += meta_events_in_report
+            for trace_id, span_id, parent_id in span_ids():
+                TRACES.add(trace_id, span_id, parent_id)
+            for finished in finish_times():
+                DELIVERY_LATENCY.record(received - finished)
 
-            logging.debug('Report Request contained {} spans.'.format(
-                spans_in_report, spans_received))
+        if VALIDATOR:
+            validate()
 
-            # Right now `response_string` is actually just b'', but we can
-            # improve this is need be to make a more sophisticated response
-            response_string = collector.ReportResponse().SerializeToString()
+        logging.debug('Report Request contained {} spans.'.format(
+            spans_in_report, spans_received))
 
-            self._send_response(200, body_string=response_string)
-        else:
-            self._send_response(400)
+        # Right now `response_string` is actually just b'', but we can
+        # improve this is need be to make a more sophisticated response
+        response_string = response.SerializeToString()
+
+        self._send_response(200, body_string=response_string)
 
 
 if __name__ == "__main__":
@@ -116,9 +574,55 @@ if __name__ == "__main__":
                         type=str,
                         choices=["typical", "slow_succeed", "slow_fail"],
                         help='how the satellites will respond to requests')
+    parser.add_argument('--cert_file',
+                        type=str,
+                        help='serve TLS using this certificate')
+    parser.add_argument('--key_file',
+                        type=str,
+                        help='private key for the --cert_file certificate')
+    parser.add_argument('--validate',
+                        action='store_true',
+                        help='validate each span received against the '
+                             'workload\'s expectations')
+    parser.add_argument('--num_tags',
+                        type=int,
+                        default=0,
+                        help='the number of tag.keyN tags set on each span')
+    parser.add_argument('--num_logs',
+                        type=int,
+                        default=0,
+                        help='the number of logs set on each span')
+    parser.add_argument('--operation_name',
+                        type=str,
+                        default='',
+                        help='the operation name of each span (any if empty)')
+    parser.add_argument('--spans_per_trace',
+                        type=int,
+                        default=0,
+                        help='if set, traces must have this many spans to '
+                             'count as complete')
+    parser.add_argument('--duplicate_detection',
+                        type=str,
+                        choices=['exact', 'bloom', 'off'],
+                        default='exact',
+                        help='how to detect spans received more than once')
+    parser.add_argument('--bloom_capacity',
+                        type=int,
+                        default=10000000,
+                        help='the number of spans the bloom filter is sized '
+                             'for')
     args = parser.parse_args()
 
     MODE = args.mode
+    TRACES = TraceAssembler(args.spans_per_trace)
+    DELIVERY_LATENCY = DeliveryLatency()
+    if args.duplicate_detection == 'exact':
+        SPAN_SET = ExactSpanSet()
+    elif args.duplicate_detection == 'bloom':
+        SPAN_SET = BloomFilter(args.bloom_capacity)
+    if args.validate:
+        VALIDATOR = Validator(
+            args.num_tags, args.num_logs, args.operation_name)
 
     logging.info(f'Running satellite on port {args.port} in {args.mode} mode')
 
@@ -126,4 +630,11 @@ if __name__ == "__main__":
         ('127.0.0.1', args.port),
         SatelliteRequestHandler
     )
+
+    if args.cert_file:
+        logging.info(f'Serving TLS with certificate {args.cert_file}')
+        context = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+        context.load_cert_chain(args.cert_file, args.key_file)
+        httpd.socket = context.wrap_socket(httpd.socket, server_side=True)
+
     httpd.serve_forever()
@@ -1,10 +1,12 @@
 import logging
+import math
 import platform
 import requests
 import time
 
 from os import path
-from .utils import BENCHMARK_DIR, start_logging_subprocess
+from .utils import BENCHMARK_DIR, PROJECT_DIR, start_logging_subprocess, \
+    generate_tls_certs
 from .exceptions import SatelliteBadResponse, DeadSatellites
 
 DEFAULT_PORTS = list(range(8360, 8368))
@@ -13,21 +15,57 @@ logger = logging.getLogger(__name__)
 
 BANDWIDTH_LIMIT_KB_PER_SEC = 50*1024
 
+# Maps each mock satellite implementation to the command which starts it.
+# The Go mock satellite is built with `make go_mock_satellite`.
+SATELLITE_ARGS = {
+    'python': ['python3', path.join(BENCHMARK_DIR, 'mock_satellite.py')],
+    'go': [path.join(PROJECT_DIR, 'clients/go_mock_satellite')],
+}
+
 
 class MockSatelliteHandler:
-    def __init__(self, port, mode):
+    def __init__(self, port, mode, tls_certs=None, trickle=True,
+                 implementation='python', validation=None,
+                 duplicate_detection='exact', spans_per_trace=None,
+                 timeline=None):
         self.port = port
 
+        # when serving TLS, the CA certificate is used to verify the
+        # satellite's certificate when we ask it for spans received
+        self._ca_cert = tls_certs[0] if tls_certs else None
+
         # we will subtract this number from how many received spans satellites
         # report this will give us the ability to reset spans_received without
         # even communicating with satellites
         self._spans_received_baseline = 0
+        self._bytes_received_baseline = 0
+        self._duplicate_spans_baseline = 0
+        self._transport_spans_baseline = {}
 
-        mock_satellite_path = path.join(BENCHMARK_DIR, 'mock_satellite.py')
         mock_satellite_logger = logging.getLogger(f'{__name__}.{port}')
 
-        args = ["python3", mock_satellite_path, str(port), mode]
-        if platform.system() == "Linux":
+        # options come before the port and mode because the Go mock satellite
+        # stops parsing flags at the first positional argument
+        args = list(SATELLITE_ARGS[implementation])
+        if tls_certs:
+            _, cert_file, key_file = tls_certs
+            args += ["--cert_file", cert_file, "--key_file", key_file]
+        if validation is not None:
+            args += [
+                "--validate",
+                "--num_tags", str(validation.get('num_tags', 0)),
+                "--num_logs", str(validation.get('num_logs', 0)),
+                "--operation_name", validation.get('operation_name', '')]
+        args += ["--duplicate_detection", duplicate_detection]
+        if spans_per_trace:
+            args += ["--spans_per_trace", str(spans_per_trace)]
+        if timeline:
+            args += ["--timeline", timeline]
+        args += [str(port), mode]
+        # trickle throttles programs by intercepting libc socket calls, which
+        # Go programs don't make
+        if trickle and implementation == 'python' and \
+                platform.system() == "Linux":
             args = [
                 "trickle",
                 "-s",
@@ -42,21 +80,110 @@ class MockSatelliteHandler:
     def is_running(self):
         return self._handler.poll() is None
 
-    def get_spans_received(self):
-        host = "http://localhost:" + str(self.port)
-        res = requests.get(host + "/spans_received")
+    def _get(self, endpoint):
+        return self._request(requests.get, endpoint)
+
+    def _request(self, method, endpoint, **kwargs):
+        if self._ca_cert:
+            host = "https://localhost:" + str(self.port)
+            res = method(host + endpoint, verify=self._ca_cert, **kwargs)
+        else:
+            host = "http://localhost:" + str(self.port)
+            res = method(host + endpoint, **kwargs)
 
         if res.status_code != 200:
-            raise SatelliteBadResponse("Error getting /spans_received.")
+            raise SatelliteBadResponse(f"Error requesting {endpoint}.")
+        return res
 
+    def _get_count(self, endpoint):
         try:
-            spans_received = int(res.text) - self._spans_received_baseline
-            return spans_received
+            return int(self._get(endpoint).text)
         except ValueError:
             raise SatelliteBadResponse("Satellite didn't sent an int.")
 
+    def get_spans_received(self):
+        return self._get_count("/spans_received") - \
+            self._spans_received_baseline
+
+    def get_spans_received_by_transport(self):
+        try:
+            received = self._get("/spans_received_by_transport").json()
+        except ValueError:
+            raise SatelliteBadResponse("Satellite didn't send JSON.")
+        return {transport: spans -
+                self._transport_spans_baseline.get(transport, 0)
+                for transport, spans in received.items()}
+
+    def get_bytes_received(self):
+        return self._get_count("/bytes_received") - \
+            self._bytes_received_baseline
+
+    def get_duplicate_spans(self):
+        return self._get_count("/duplicate_spans") - \
+            self._duplicate_spans_baseline
+
+    def get_trace_summary(self):
+        try:
+            return self._get("/traces").json()
+        except ValueError:
+            raise SatelliteBadResponse("Satellite didn't send JSON.")
+
+    def reset_traces(self):
+        self._request(requests.post, "/traces/reset")
+
+    def get_delivery_latency(self):
+        try:
+            return self._get("/delivery_latency").json()
+        except ValueError:
+            raise SatelliteBadResponse("Satellite didn't send JSON.")
+
+    def reset_delivery_latency(self):
+        self._request(requests.post, "/delivery_latency/reset")
+
+    def get_validation(self):
+        try:
+            return self._get("/validation").json()
+        except ValueError:
+            raise SatelliteBadResponse("Satellite didn't send JSON.")
+
+    def reset_validation(self):
+        self._request(requests.post, "/validation/reset")
+
+    def get_fault(self):
+        try:
+            return self._get("/admin/fault").json()
+        except ValueError:
+            raise SatelliteBadResponse("Satellite didn't send JSON.")
+
+    def set_fault(self, action):
+        self._request(requests.post, "/admin/fault", data=action)
+
+    def start_timeline(self, steps):
+        self._request(requests.post, "/admin/timeline",
+                      data="\n".join(steps))
+
+    def get_meta_events_received(self):
+        return self._get_count("/meta_events_received")
+
+    def get_metrics_requests_received(self):
+        return self._get_count("/metrics_requests_received")
+
     def reset_spans_received(self):
         self._spans_received_baseline += self.get_spans_received()
+        for transport, spans in \
+                self.get_spans_received_by_transport().items():
+            self._transport_spans_baseline[transport] = \
+                self._transport_spans_baseline.get(transport, 0) + spans
+
+    def reset_bytes_received(self):
+        self._bytes_received_baseline += self.get_bytes_received()
+
+    def reset_duplicate_spans(self):
+        self._duplicate_spans_baseline += self.get_duplicate_spans()
+
+    def reset_duplicate_detection(self):
+        self._request(requests.post, "/duplicate_spans/reset")
+        self._duplicate_spans_baseline = 0
 
     def terminate(self):
         # cross-platform way to terminate a program
@@ -71,7 +198,10 @@ class MockSatelliteHandler:
 class MockSatelliteGroup:
     """ A group of mock satellites. """
 
-    def __init__(self, mode, ports=DEFAULT_PORTS):
+    def __init__(self, mode, ports=DEFAULT_PORTS, tls=False, trickle=True,
+                 implementation='python', validation=None,
+                 duplicate_detection='exact', spans_per_trace=None,
+                 timeline=None):
         """ Initializes and starts a group of mock satellites.
 
         Parameters
@@ -82,16 +212,84 @@ class MockSatelliteGroup:
         ports : list of int
             Ports the mock satellites should listen on. A mock satellite will
             be started for each specified port.
+        tls : bool
+            If True, a throwaway CA and server certificate are generated and
+            the mock satellites serve TLS with them. Clients are told to trust
+            the CA through `ca_cert_file`.
+        trickle : bool
+            If True, mock satellites are run under `trickle` on Linux to cap
+            their bandwidth. Set this to False when the client limits its own
+            bandwidth with the 'FaultBandwidth' tracer option. The Go mock
+            satellites are never run under `trickle`.
+        implementation : str
+            Which mock satellite to run: 'python' (benchmark/mock_satellite.py)
+            or 'go' (clients/go_mock_satellite), which serves the same
+            endpoints and modes but uses far less CPU at high span rates.
+        validation : dict, optional
+            If set, mock satellites validate each span they receive against
+            the workload's expectations, given by the keys 'num_tags' and
+            'num_logs' (both 0 if missing) and 'operation_name' (any
+            non-empty name if missing). See `get_validation`.
+        duplicate_detection : str
+            How mock satellites detect spans they receive more than once:
+            'exact' remembers every span, 'bloom' uses a bloom filter sized
+            for 10 million spans, which needs far less memory but may
+            mistake about 0.05% of spans for duplicates, and 'off' disables
+            detection. See `get_duplicate_spans`.
+        spans_per_trace : int, optional
+            If set, traces must have this many spans to count as complete in
+            `get_trace_summary`. Otherwise a trace is complete if it has its
+            root span and no orphan spans, so traces which lost their leaves
+            can't be told apart from complete ones.
+        timeline : str, optional
+            Path of a file of fault steps, such as 'at 30s respond 503', which
+            the mock satellites run from each time they start. Only the Go
+            mock satellites support faults. See `start_timeline`.
 
         Raises
         ------
+        ValueError
+            If `implementation` is not 'python' or 'go', or if `timeline` is
+            set for the Python mock satellites.
         DeadSatellites
             If one or more of the satellites died during startup.
         """
 
+        if implementation not in SATELLITE_ARGS:
+            raise ValueError(
+                f'Unknown mock satellite implementation {implementation}.')
+        if timeline and implementation != 'go':
+            raise ValueError('Only the Go mock satellites support faults.')
+
+        # certificates are kept across restarts so that clients which were
+        # started with the CA can reconnect
+        self._tls_certs = generate_tls_certs() if tls else None
+        self._trickle = trickle
+        self._implementation = implementation
+        self._validation = validation
+        self._duplicate_detection = duplicate_detection
+        self._spans_per_trace = spans_per_trace
+        self._timeline = timeline
+        self._start(mode, ports)
+
+    @property
+    def ca_cert_file(self):
+        """ Path of the CA certificate clients should trust, or None if the
+        satellites serve plaintext. """
+
+        return self._tls_certs[0] if self._tls_certs else None
+
+    def _start(self, mode, ports):
         self._ports = ports
-        self._satellites = \
-            [MockSatelliteHandler(port, mode) for port in ports]
+        self._satellites = [
+            MockSatelliteHandler(
+                port, mode, tls_certs=self._tls_certs, trickle=self._trickle,
+                implementation=self._implementation,
+                validation=self._validation,
+                duplicate_detection=self._duplicate_detection,
+                spans_per_trace=self._spans_per_trace,
+                timeline=self._timeline)
+            for port in ports]
 
         time.sleep(1)
 
@@ -131,6 +329,367 @@ class MockSatelliteGroup:
         logger.info(f'All satellites have {received} spans.')
         return received
 
+    def get_bytes_received(self):
+        """ Gets the number of report payload bytes that mock satellites have
+        received.
+
+        Returns
+        -------
+        int
+            The number of bytes received.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        received = sum([s.get_bytes_received() for s in self._satellites])
+        logger.info(f'All satellites have {received} bytes.')
+        return received
+
+    def get_spans_received_by_transport(self):
+        """ Gets the number of spans that mock satellites have received since
+        the last reset, broken down by the transport which delivered them.
+        The counts add up to `get_spans_received`.
+
+        Returns
+        -------
+        dict
+            Maps each transport, 'http' or 'grpc', to the number of spans
+            received over it. OTLP/HTTP exports are counted as 'http'.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        received = {}
+        for s in self._satellites:
+            for transport, spans in \
+                    s.get_spans_received_by_transport().items():
+                received[transport] = received.get(transport, 0) + spans
+        logger.info(f'All satellites have {received} spans by transport.')
+        return received
+
+    def get_duplicate_spans(self):
+        """ Gets the number of spans that mock satellites have received since
+        the last reset which they had already received, including in reports
+        they failed. Spans which a tracer retries after a failed report are
+        counted here. Always 0 if duplicate detection is off.
+
+        Returns
+        -------
+        int
+            The number of duplicate spans received.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        duplicates = sum([s.get_duplicate_spans() for s in self._satellites])
+        logger.info(f'All satellites have {duplicates} duplicate spans.')
+        return duplicates
+
+    def get_trace_summary(self):
+        """ Rebuilds the traces mock satellites have received since the last
+        reset from the spans' contexts and references, and counts how many
+        stayed usable. Each satellite rebuilds the traces it received, so a
+        trace whose spans were reported to several satellites is counted by
+        each of them.
+
+        Returns
+        -------
+        dict
+            'Traces' counts the traces received, 'CompleteTraces' those with
+            their root span and no orphan spans, 'TracesMissingRoot' those
+            without a root span and 'OrphanSpans' the spans whose parent
+            never arrived.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        summary = {}
+        for s in self._satellites:
+            for key, count in s.get_trace_summary().items():
+                summary[key] = summary.get(key, 0) + count
+        logger.info(f'All satellites have {summary} traces.')
+        return summary
+
+    def get_delivery_latency(self):
+        """ Gets how long spans took to reach the mock satellites after they
+        finished, since the last reset. Latencies are counted in buckets
+        which are accurate to within about 4.4%.
+
+        Returns
+        -------
+        dict
+            'Count' is the number of spans timed, 'Mean' and 'Max' their mean
+            and maximum latency, and 'P50', 'P90', 'P99' and 'P99.9' the
+            latency percentiles, all in seconds. 'Histogram' is a list of the
+            upper bound in seconds and the count of each non-empty bucket.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        summaries = [s.get_delivery_latency() for s in self._satellites]
+        count = sum(summary['Count'] for summary in summaries)
+        max_latency = max(summary['Max'] for summary in summaries)
+
+        # the satellites share bucket bounds, which are rounded so that
+        # floating point differences between implementations don't split a
+        # bucket
+        counts = {}
+        for summary in summaries:
+            for bound, bucket_count in summary['Histogram']:
+                bound = round(bound, 12)
+                counts[bound] = counts.get(bound, 0) + bucket_count
+        histogram = [[bound, counts[bound]] for bound in sorted(counts)]
+
+        latency = {
+            'Count': count,
+            'Max': max_latency,
+            'Mean': sum(summary['Mean'] * summary['Count']
+                        for summary in summaries) / count if count else 0,
+            'Histogram': histogram,
+        }
+        for name, percent in [('P50', 50), ('P90', 90), ('P99', 99),
+                              ('P99.9', 99.9)]:
+            rank = math.ceil(percent / 100 * count)
+            seen = 0
+            latency[name] = max_latency
+            for bound, bucket_count in histogram:
+                seen += bucket_count
+                if seen >= rank:
+                    latency[name] = min(bound, max_latency)
+                    break
+        logger.info(f'Median delivery latency is {latency["P50"]:.3f}s.')
+        return latency
+
+    def get_validation(self):
+        """ Gets the combined validation reports of the mock satellites, which
+        cover every span received since they started or were last reset.
+
+        Returns
+        -------
+        dict
+            'Enabled' is False if the group wasn't started with `validation`.
+            Otherwise 'SpansValidated' and 'InvalidSpans' count spans,
+            'Problems' maps each problem ('OperationName', 'TagCount',
+            'TagKeys', 'LogCount', 'Duration' and 'References') to the number
+            of spans which have it and 'Examples' describes a few invalid
+            spans.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        reports = [s.get_validation() for s in self._satellites]
+        if not all(report['Enabled'] for report in reports):
+            return {'Enabled': False}
+
+        validation = {
+            'Enabled': True,
+            'SpansValidated': 0,
+            'InvalidSpans': 0,
+            'Problems': {},
+            'Examples': [],
+        }
+        for report in reports:
+            validation['SpansValidated'] += report['SpansValidated']
+            validation['InvalidSpans'] += report['InvalidSpans']
+            for problem, spans in report['Problems'].items():
+                validation['Problems'][problem] = \
+                    validation['Problems'].get(problem, 0) + spans
+            validation['Examples'] += report['Examples']
+        logger.info(f'{validation["InvalidSpans"]} of '
+                    f'{validation["SpansValidated"]} spans failed '
+                    'validation.')
+        return validation
+
+    def get_faults(self):
+        """ Gets the faults which each mock satellite is injecting.
+
+        Returns
+        -------
+        list of dict
+            The faults of each satellite, in the order of `ports`. 'Mode' is
+            the mode overriding the satellite's own, or '' if there is none,
+            'Status' is the HTTP status reports fail with, or 0 if they
+            don't, 'Latency' is the latency added to reports in seconds and
+            'Drop' is whether report connections are closed without a
+            response.
+
+        Raises
+        ------
+        ValueError
+            If the mock satellites aren't the Go implementation.
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        self._check_faults_supported()
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        return [s.get_fault() for s in self._satellites]
+
+    def set_fault(self, action):
+        """ Changes the faults the mock satellites inject into the reports
+        they receive, immediately. Faults apply to reports over every
+        transport, but not to the satellites' other endpoints.
+
+        Parameters
+        ----------
+        action : str
+            One of 'respond STATUS', which fails reports with an HTTP error
+            STATUS (mapped to a gRPC status code for gRPC reports), 'add
+            DURATION latency', which delays every report by a further Go
+            duration such as '2s', 'drop connections', which closes connections
+            instead of responding to reports, 'mode MODE', which makes the
+            satellites act as if started in MODE, or 'recover', which clears
+            every fault.
+
+        Raises
+        ------
+        ValueError
+            If the mock satellites aren't the Go implementation.
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites rejected `action`.
+        """
+
+        self._check_faults_supported()
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        logger.info(f"Setting satellite fault: {action}")
+        for s in self._satellites:
+            s.set_fault(action)
+
+    def start_timeline(self, steps):
+        """ Starts running a timeline of fault steps from now, replacing any
+        timeline which is still running. Faults already injected stay until a
+        step changes them.
+
+        Parameters
+        ----------
+        steps : list of str
+            Steps such as 'at 45s add 2s latency', each applying a `set_fault`
+            action once the timeline has run for a Go duration.
+
+        Raises
+        ------
+        ValueError
+            If the mock satellites aren't the Go implementation.
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites rejected `steps`.
+        """
+
+        self._check_faults_supported()
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        logger.info(f"Starting a timeline of {len(steps)} satellite faults.")
+        for s in self._satellites:
+            s.start_timeline(steps)
+
+    def _check_faults_supported(self):
+        if self._implementation != 'go':
+            raise ValueError('Only the Go mock satellites support faults.')
+
+    def get_meta_events_received(self):
+        """ Gets the number of meta event spans that mock satellites have
+        received since they started. These are not included in
+        `get_spans_received`.
+
+        Returns
+        -------
+        int
+            The number of meta event spans received.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        return sum([s.get_meta_events_received() for s in self._satellites])
+
+    def get_metrics_requests_received(self):
+        """ Gets the number of system metrics ingest requests that mock
+        satellites have received since they started.
+
+        Returns
+        -------
+        int
+            The number of metrics ingest requests received.
+
+        Raises
+        ------
+        DeadSatellites
+            If one or more of the mock satellites have died unexpctedly.
+        SatelliteBadResponse
+            If one or more of the mock satellites sent a bad response.
+        """
+
+        if not self._satellites or not self.all_running():
+            raise DeadSatellites("One or more satellites is not running.")
+
+        return sum(
+            [s.get_metrics_requests_received() for s in self._satellites])
+
     def all_running(self):
         """ Checks if all of the mock satellites in the group are running.
 
@@ -168,6 +727,129 @@ class MockSatelliteGroup:
         for s in self._satellites:
             s.reset_spans_received()
 
+    def reset_bytes_received(self):
+        """ Resets the number of bytes that the group of mock satellites have
+        received to 0. Does nothing if the satellite group has been shutdown.
+
+        Raises
+        ------
+        SatelliteBadResponse
+            If we were unable to reset the number of bytes received.
+        """
+
+        if not self._satellites:
+            logger.warn(
+                "Cannot reset bytes received since satellites are shutdown.")
+            return
+
+        logger.info("Resetting bytes received.")
+        for s in self._satellites:
+            s.reset_bytes_received()
+
+    def reset_traces(self):
+        """ Forgets the traces that the group of mock satellites have
+        received. Spans of these traces received after the reset are ignored,
+        so traces in flight during the reset aren't counted as incomplete.
+        Does nothing if the satellite group has been shutdown.
+
+        Raises
+        ------
+        SatelliteBadResponse
+            If we were unable to reset the traces received.
+        """
+
+        if not self._satellites:
+            logger.warn("Cannot reset traces since satellites are shutdown.")
+            return
+
+        logger.info("Resetting traces.")
+        for s in self._satellites:
+            s.reset_traces()
+
+    def reset_delivery_latency(self):
+        """ Forgets the delivery latencies that the group of mock satellites
+        have recorded. Does nothing if the satellite group has been shutdown.
+
+        Raises
+        ------
+        SatelliteBadResponse
+            If we were unable to reset the delivery latencies.
+        """
+
+        if not self._satellites:
+            logger.warn(
+                "Cannot reset delivery latency since satellites are shutdown.")
+            return
+
+        logger.info("Resetting delivery latency.")
+        for s in self._satellites:
+            s.reset_delivery_latency()
+
+    def reset_validation(self):
+        """ Forgets the spans that the group of mock satellites have
+        validated, including the root span of each trace, so that validation
+        reports only cover spans received from now on. Does nothing if the
+        satellite group has been shutdown.
+
+        Raises
+        ------
+        SatelliteBadResponse
+            If we were unable to reset validation.
+        """
+
+        if not self._satellites:
+            logger.warn(
+                "Cannot reset validation since satellites are shutdown.")
+            return
+
+        logger.info("Resetting validation.")
+        for s in self._satellites:
+            s.reset_validation()
+
+    def reset_duplicate_detection(self):
+        """ Makes the group of mock satellites forget the spans they have
+        received, so that spans received before the reset aren't counted as
+        duplicates, and resets the number of duplicate spans to 0. The exact
+        span set grows with every span received, so this bounds the
+        satellites' memory over many tests. Does nothing if the satellite
+        group has been shutdown.
+
+        Raises
+        ------
+        SatelliteBadResponse
+            If we were unable to reset duplicate detection.
+        """
+
+        if not self._satellites:
+            logger.warn("Cannot reset duplicate detection since satellites " +
+                        "are shutdown.")
+            return
+
+        logger.info("Resetting duplicate detection.")
+        for s in self._satellites:
+            s.reset_duplicate_detection()
+
+    def reset_duplicate_spans(self):
+        """ Resets the number of duplicate spans that the group of mock
+        satellites have received to 0. Spans received before the reset are
+        still remembered, so resending them later counts as a duplicate. Does
+        nothing if the satellite group has been shutdown.
+
+        Raises
+        ------
+        SatelliteBadResponse
+            If we were unable to reset the number of duplicate spans.
+        """
+
+        if not self._satellites:
+            logger.warn(
+                "Cannot reset duplicate spans since satellites are shutdown.")
+            return
+
+        logger.info("Resetting duplicate spans.")
+        for s in self._satellites:
+            s.reset_duplicate_spans()
+
     def start(self, mode, ports=DEFAULT_PORTS):
         """ Restarts the group of mock satellites. Should only be called if the
         group is currently shutdown.
@@ -188,7 +870,7 @@ class MockSatelliteGroup:
             return
 
         logger.info("Starting up mock satellite group.")
-        self.__init__(mode, ports=ports)
+        self._start(mode, ports)
 
     def shutdown(self):
         """ Shutdown all satellites. Should only be called if the satellite
@@ -1,14 +1,17 @@
-from .controller import Controller
+from .controller import Controller, ControlServer, CONTROLLER_PORT
 from .satellite import MockSatelliteGroup as SatelliteGroup
 from .exceptions import DeadSatellites
 import pytest
 import requests
+import json
+from os import path
 from time import time
 import logging
 
 import lightstep
 # we have to do this because the locally compiled proto will conflict
 from lightstep import collector_pb2 as collector
+from .generated import otlp_trace_pb2 as otlp
 
 logging.basicConfig(level=logging.INFO)
 
@@ -108,6 +111,80 @@ class TestController:
 
             assert result.spans_sent == 100
 
+    def test_benchmark_trials(self):
+        """ A warm go client should run every trial and each result should
+        only count the spans received during its own trial. """
+
+        with Controller('go') as controller:
+            with SatelliteGroup('typical', implementation='go') as satellites:
+                results = controller.benchmark_trials(
+                    3, satellites=satellites, trace=True, runtime=2)
+
+                assert len(results) == 3
+                for result in results:
+                    assert result.spans_sent > 0
+                    assert result.spans_received == result.spans_sent
+
+                results = controller.benchmark_trials(
+                    2, satellites=satellites, trace=True, no_flush=True,
+                    runtime=2)
+
+                # unflushed spans are closed out after each trial's results
+                # are posted, so they aren't counted in the next trial
+                assert len(results) == 2
+                assert results[1].spans_received <= results[1].spans_sent
+
+
+class TestControlServer:
+    COMMAND = {
+        'Trace': True,
+        'Sleep': 25,
+        'SleepInterval': 10**8,
+        'Work': 100,
+        'Repeat': 500,
+        'NoFlush': False,
+    }
+    URL = f'http://localhost:{CONTROLLER_PORT}'
+
+    def test_control_messages(self):
+        """ Commands are handed out in order, without the keys which aren't
+        part of a control message, and then there are none left. """
+
+        commands = [
+            dict(self.COMMAND, Repeat=1, TracerOptions={'Inject': True}),
+            dict(self.COMMAND, Repeat=2)]
+        with ControlServer(commands):
+            response = requests.get(self.URL + '/control')
+            assert response.status_code == 200
+            assert response.json() == dict(self.COMMAND, Repeat=1)
+            assert requests.get(self.URL + '/control').json()['Repeat'] == 2
+            assert requests.get(self.URL + '/control').status_code == 204
+
+    def test_results(self):
+        with ControlServer([self.COMMAND]) as server:
+            assert server.results == []
+            response = requests.post(self.URL + '/result', data=json.dumps({
+                'SpansSent': 500,
+                'ProgramTime': 1.5,
+                'ClockTime': 2.0,
+                'CPUList': [0.75, 0.75],
+                'MemoryList': [15454208, 15544320],
+            }))
+            assert response.status_code == 200
+
+            assert len(server.results) == 1
+            result = server.results[0]
+            assert result.spans_sent == 500
+            assert result.cpu_usage == .75
+            assert result.memory_list == [15454208, 15544320]
+
+    def test_bad_requests(self):
+        with ControlServer([self.COMMAND]) as server:
+            assert requests.get(self.URL + '/result').status_code == 404
+            response = requests.post(self.URL + '/result', data='{')
+            assert response.status_code == 400
+            assert server.results == []
+
 
 class TestMockSatelliteGroup:
     def test_all_running(self):
@@ -155,6 +232,24 @@ class TestMockSatelliteGroup:
 
             assert satellites.get_spans_received() == 1
 
+    def test_bytes_received(self):
+        """ Satellites should count the report bytes they receive until they
+        are reset. """
+
+        report_request = self._make_report_request(10)
+        with SatelliteGroup('typical') as satellites:
+            assert satellites.get_bytes_received() == 0
+
+            for _ in range(3):
+                requests.post(
+                    url='http://localhost:8360/api/v2/reports',
+                    data=report_request,
+                    headers={'Content-Type': 'application/octet-stream'})
+            assert satellites.get_bytes_received() == 3 * len(report_request)
+
+            satellites.reset_bytes_received()
+            assert satellites.get_bytes_received() == 0
+
     def test_startup_fail(self):
         """ Satellites should raise an exception if we try to start two
         instances, because they bind on the same ports. """
@@ -175,6 +270,173 @@ class TestMockSatelliteGroup:
             report_request.spans.append(span)
         return report_request.SerializeToString()
 
+    def _make_trace_report(self, spans):
+        """ make a report of (trace ID, span ID, parent span ID) spans, where
+        root spans have a parent span ID of 0 """
+
+        report_request = collector.ReportRequest()
+        for trace_id, span_id, parent_id in spans:
+            span = report_request.spans.add()
+            span.operation_name = "isaac_op"
+            span.span_context.trace_id = trace_id
+            span.span_context.span_id = span_id
+            if parent_id:
+                reference = span.references.add()
+                reference.span_context.trace_id = trace_id
+                reference.span_context.span_id = parent_id
+        return report_request.SerializeToString()
+
+    def _post_report(self, report_request):
+        return requests.post(
+            url='http://localhost:8360/api/v2/reports',
+            data=report_request,
+            headers={'Content-Type': 'application/octet-stream'})
+
+    def test_trace_summary(self):
+        """ Satellites should rebuild traces from span references, and
+        ignore the spans of traces received before a reset. """
+
+        with SatelliteGroup('typical') as satellites:
+            self._post_report(self._make_trace_report([
+                (1, 1, 0), (1, 2, 1),  # complete
+                (2, 2, 1),  # missing its root
+                (3, 1, 0), (3, 3, 2),  # has an orphan
+            ]))
+            assert satellites.get_trace_summary() == {
+                'Traces': 3,
+                'CompleteTraces': 1,
+                'TracesMissingRoot': 1,
+                'OrphanSpans': 2,
+            }
+
+            satellites.reset_traces()
+            self._post_report(self._make_trace_report([
+                (1, 3, 2),  # its trace was received before the reset
+                (4, 1, 0), (4, 2, 1),
+            ]))
+            assert satellites.get_trace_summary() == {
+                'Traces': 1,
+                'CompleteTraces': 1,
+                'TracesMissingRoot': 0,
+                'OrphanSpans': 0,
+            }
+
+    def test_duplicate_spans(self):
+        """ Satellites should count spans they have already received as
+        duplicates, and forget them when duplicate detection is reset. """
+
+        report_request = self._make_trace_report(
+            [(1, 1, 0), (1, 2, 1), (2, 1, 0)])
+
+        with SatelliteGroup('typical') as satellites:
+            self._post_report(report_request)
+            assert satellites.get_duplicate_spans() == 0
+
+            self._post_report(report_request)
+            assert satellites.get_duplicate_spans() == 3
+
+            satellites.reset_duplicate_detection()
+            assert satellites.get_duplicate_spans() == 0
+            self._post_report(report_request)
+            assert satellites.get_duplicate_spans() == 0
+
+    def test_delivery_latency(self):
+        """ Satellites should time how long spans took to arrive after they
+        finished, to within a bucket, until they're reset. """
+
+        report_request = collector.ReportRequest()
+        for i in range(10):
+            span = report_request.spans.add()
+            span.operation_name = "isaac_op"
+            # finished 10 seconds ago
+            span.start_timestamp.FromSeconds(int(time()) - 11)
+            span.duration_micros = 10**6
+
+        with SatelliteGroup('typical') as satellites:
+            self._post_report(report_request.SerializeToString())
+            latency = satellites.get_delivery_latency()
+            assert latency['Count'] == 10
+            assert 10 <= latency['P50'] <= latency['Max'] < 12
+            assert sum(count for _, count in latency['Histogram']) == 10
+
+            satellites.reset_delivery_latency()
+            latency = satellites.get_delivery_latency()
+            assert latency['Count'] == 0
+            assert latency['Histogram'] == []
+
+    def test_faults_unsupported(self):
+        """ Only the Go mock satellites inject faults, so the Python ones
+        should refuse fault actions and timelines rather than ignore them. """
+
+        with pytest.raises(ValueError):
+            SatelliteGroup('typical', timeline='outage.timeline')
+
+        with SatelliteGroup('typical') as satellites:
+            with pytest.raises(ValueError):
+                satellites.get_faults()
+            with pytest.raises(ValueError):
+                satellites.set_fault('respond 503')
+            with pytest.raises(ValueError):
+                satellites.start_timeline(['at 1s recover'])
+
+            # reports still succeed
+            response = self._post_report(self._make_report_request(10))
+            assert response.status_code == 200
+            assert satellites.get_spans_received() == 10
+
+    def test_otlp_validation(self):
+        """ Satellites started with validation should check the content of
+        OTLP spans, reading tags from attributes and logs from events. """
+
+        export_request = otlp.ExportTraceServiceRequest()
+        spans = export_request.resource_spans.add().scope_spans.add().spans
+        for span_id, parent_id, events in [(1, 0, 1), (2, 1, 0)]:
+            span = spans.add()
+            span.trace_id = (1).to_bytes(16, 'big')
+            span.span_id = span_id.to_bytes(8, 'big')
+            if parent_id:
+                span.parent_span_id = parent_id.to_bytes(8, 'big')
+            span.name = 'isaac_op'
+            span.start_time_unix_nano = 1000
+            span.end_time_unix_nano = 2000
+            for i in range(2):
+                span.attributes.add().key = f'tag.key{i}'
+            for i in range(events):
+                span.events.add().name = 'log'
+
+        validation = {'num_tags': 2, 'num_logs': 1,
+                      'operation_name': 'isaac_op'}
+        with SatelliteGroup('typical', validation=validation) as satellites:
+            response = requests.post(
+                url='http://localhost:8360/v1/traces',
+                data=export_request.SerializeToString(),
+                headers={'Content-Type': 'application/x-protobuf'})
+            assert response.status_code == 200
+
+            validation = satellites.get_validation()
+            assert validation['SpansValidated'] == 2
+            assert validation['InvalidSpans'] == 1
+            assert validation['Problems']['LogCount'] == 1
+            assert sum(validation['Problems'].values()) == 1
+
+    def test_tls(self):
+        """ Satellites started with tls=True should only serve TLS, with a
+        certificate signed by the CA in ca_cert_file. """
+
+        with SatelliteGroup('typical', tls=True) as satellites:
+            assert path.exists(satellites.ca_cert_file)
+
+            response = requests.post(
+                url='https://localhost:8360/api/v2/reports',
+                data=self._make_report_request(10),
+                headers={'Content-Type': 'application/octet-stream'},
+                verify=satellites.ca_cert_file)
+            assert response.status_code == 200
+            assert satellites.get_spans_received() == 10
+
+            with pytest.raises(requests.exceptions.ConnectionError):
+                requests.get('http://localhost:8360/spans_received')
+
     def test_satellite_throughput(self):
         """ Make sure that a single satellite can ingest spans at a rate of
         at least 2000 / second without dropping any. """
@@ -1,6 +1,7 @@
 from http.server import BaseHTTPRequestHandler
 from os import path, makedirs
 import subprocess
+import tempfile
 from threading import Thread
 import logging
 import sys
@@ -9,9 +10,11 @@ BENCHMARK_DIR = path.dirname(path.realpath(__file__))
 PROJECT_DIR = path.join(BENCHMARK_DIR, "..")
 
 
-def start_logging_subprocess(cli_args, logger, popen_class=subprocess.Popen):
+def start_logging_subprocess(cli_args, logger, popen_class=subprocess.Popen,
+                             stdout_filter=None):
     # starts a subprocess, logs its stdout and stderr using logger.debug and
-    # logger.error
+    # logger.error. if stdout_filter is set, it is called with the subprocess
+    # handle and each line of stdout before the line is logged.
 
     handler = popen_class(
         cli_args,
@@ -20,9 +23,15 @@ def start_logging_subprocess(cli_args, logger, popen_class=subprocess.Popen):
         bufsize=0  # 0 sets this to unbuffered
     )
 
+    log_stdout = logger.debug
+    if stdout_filter:
+        def log_stdout(line):
+            stdout_filter(handler, line)
+            logger.debug(line)
+
     stdout_thread = Thread(
         target=_log_output,
-        args=[handler.stdout, logger.debug])
+        args=[handler.stdout, log_stdout])
     stdout_thread.daemon = True
     stdout_thread.start()
 
@@ -35,6 +44,46 @@ def start_logging_subprocess(cli_args, logger, popen_class=subprocess.Popen):
     return handler
 
 
+def generate_tls_certs(cert_dir=None):
+    # generates a throwaway CA and a server certificate for localhost signed by
+    # it using the openssl command-line tool. returns the paths of the CA
+    # certificate, the server certificate and the server private key.
+
+    if cert_dir is None:
+        cert_dir = tempfile.mkdtemp(prefix='lightstep-benchmarks-tls-')
+
+    ca_key = path.join(cert_dir, 'ca.key')
+    ca_cert = path.join(cert_dir, 'ca.crt')
+    server_key = path.join(cert_dir, 'server.key')
+    server_csr = path.join(cert_dir, 'server.csr')
+    server_cert = path.join(cert_dir, 'server.crt')
+    server_ext = path.join(cert_dir, 'server.ext')
+
+    # Go and Python both require the hostname to be in subjectAltName
+    with open(server_ext, 'w') as file:
+        file.write('subjectAltName=DNS:localhost,IP:127.0.0.1\n')
+
+    for args in [
+            ['req', '-x509', '-newkey', 'rsa:2048', '-nodes', '-days', '1',
+             '-subj', '/CN=LightStep Benchmarks CA',
+             '-addext', 'basicConstraints=critical,CA:TRUE',
+             '-addext', 'keyUsage=critical,keyCertSign,cRLSign',
+             '-keyout', ca_key, '-out', ca_cert],
+            ['req', '-newkey', 'rsa:2048', '-nodes',
+             '-subj', '/CN=localhost',
+             '-keyout', server_key, '-out', server_csr],
+            ['x509', '-req', '-days', '1', '-in', server_csr,
+             '-CA', ca_cert, '-CAkey', ca_key, '-CAcreateserial',
+             '-extfile', server_ext, '-out', server_cert]]:
+        subprocess.run(
+            ['openssl'] + args,
+            check=True,
+            stdout=subprocess.DEVNULL,
+            stderr=subprocess.DEVNULL)
+
+    return ca_cert, server_cert, server_key
+
+
 def _log_output(pipe, logger_method):
     # read until we reach ''
     for line in iter(pipe.readline, b''):
@@ -7,7 +7,15 @@ import (
 	"github.com/lightstep/lightstep-tracer-go"
 	"github.com/opentracing/opentracing-go"
 	otlog "github.com/opentracing/opentracing-go/log"
+	"go.opentelemetry.io/otel"
+	otelbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"log"
 	"math"
+	"net/http"
+	"runtime/trace"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +23,17 @@ const (
 	satellitePort = 8360
 	spansPerLoop  = 6
 
+	// The controller starts measuring the test when the client prints a line
+	// of JSON with this key at the end of its warmup
+	measurementStartedMarker = "MeasurementStarted"
+
 	// These values match the default tracer configuration
 	reportingPeriod    = 2500 * time.Millisecond
 	minReportingPeriod = 100 * time.Millisecond
 	maxBufferedSpans   = 1000
 )
 
-var argTracer = flag.String("traceR", "", "Which LightStep tracer to use")
+var argTracer = flag.String("traceR", "", "Which tracer to use (lightstep or otel_bridge)")
 var argTrace = flag.Int("trace", 0, "Whether to trace")
 var argSleep = flag.Float64("sleep", 0, "The amount of time to sleep for each span")
 var argSleepInterval = flag.Int("sleep_interval", 0, "The duration of each sleep")
@@ -30,8 +42,23 @@ var argRepeat = flag.Int("repeat", 0, "The number of span generation repetitions
 var argNoFlush = flag.Int("no_flush", 0, "Whether to flush on finishing")
 var argNumTags = flag.Int("num_tags", 0, "The number of tags to set on a span")
 var argNumLogs = flag.Int("num_logs", 0, "The number of logs to set on a span")
+var argInject = flag.Int("inject", 0, "Whether to inject each client span's context into HTTP headers")
+var argReportingPeriod = flag.Duration("reporting_period", reportingPeriod, "The maximum duration between reports to the collector")
+var argMinReportingPeriod = flag.Duration("min_reporting_period", minReportingPeriod, "The minimum duration between reports to the collector")
+var argMaxBufferedSpans = flag.Int("max_buffered_spans", maxBufferedSpans, "The maximum number of spans buffered between reports")
+var argReportTimeout = flag.Duration("report_timeout", lightstep.DefaultReportTimeout, "The timeout for a single report to the collector")
+var argMaxLogsPerSpan = flag.Int("max_logs_per_span", lightstep.DefaultMaxLogsPerSpan, "The maximum number of logs kept on a span")
+var argDropSpanLogs = flag.Int("drop_span_logs", 0, "Whether the tracer should drop all span logs")
+var argTransport = flag.String("transport", "http", "The transport to report spans over (http or grpc)")
+var argCACertFile = flag.String("ca_cert_file", "", "If set, report over TLS and trust the CA certificate in this file")
+var argMetaEventReporting = flag.Int("meta_event_reporting", 0, "Whether the tracer should report meta events")
+var argDisableSystemMetrics = flag.Int("disable_system_metrics", 0, "Whether to disable system metrics reporting")
+var argWarmup = flag.Duration("warmup", 0, "How long to generate spans before measuring the test")
+var argSystemMetricsFrequency = flag.Duration("system_metrics_frequency", lightstep.DefaultSystemMetricsMeasurementFrequency, "How often the tracer measures and reports system metrics")
 
 var workResult = 0.0
+var tracerEvents *eventSummary = nil
+var bridgeProvider *sdktrace.TracerProvider = nil
 var tagKeys []string = nil
 var tagVals []string = nil
 var logKeys []string = nil
@@ -70,38 +97,103 @@ func doWork(units int) {
 	workResult = x
 }
 
-func buildTracer() opentracing.Tracer {
+// buildTracer returns the tracer selected by --traceR along with a function
+// that flushes and closes it.
+func buildTracer() (opentracing.Tracer, func(context.Context)) {
 	if *argTrace == 0 {
-		return opentracing.NoopTracer{}
+		return opentracing.NoopTracer{}, func(context.Context) {}
+	}
+	switch *argTracer {
+	case "", "lightstep":
+		tracerEvents = newEventSummary()
+		tracerEvents.install()
+		liveEvents.Store(tracerEvents)
+		tracer := buildLightStepTracer()
+		// meta events are reported through the global tracer
+		if *argMetaEventReporting != 0 {
+			opentracing.SetGlobalTracer(tracer)
+		}
+		return tracer, tracer.Close
+	case "otel_bridge":
+		return buildOTelBridgeTracer()
+	}
+	log.Fatalf("unknown tracer %q", *argTracer)
+	return nil, nil
+}
+
+// buildOTelBridgeTracer wraps an OpenTelemetry SDK tracer in the
+// OpenTracing bridge so that the unchanged OpenTracing code path in
+// generateSpans measures the overhead the bridge adds.
+func buildOTelBridgeTracer() (opentracing.Tracer, func(context.Context)) {
+	provider, err := buildOTelTracerProvider()
+	if err != nil {
+		log.Fatalf("unable to build OpenTelemetry tracer: %v", err)
+	}
+	bridgeProvider = provider
+	bridgeTracer, wrapperProvider := otelbridge.NewTracerPair(provider.Tracer(otelServiceName))
+	otel.SetTracerProvider(wrapperProvider)
+	return bridgeTracer, func(ctx context.Context) {
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("error shutting down tracer: %v", err)
+		}
+	}
+}
+
+// flushTracer sends the spans buffered by the tracer to the collector.
+func flushTracer(ctx context.Context, tracer opentracing.Tracer) {
+	if lightstepTracer, ok := tracer.(lightstep.Tracer); ok {
+		lightstepTracer.Flush(ctx)
+	}
+	if bridgeProvider != nil {
+		if err := bridgeProvider.ForceFlush(ctx); err != nil {
+			log.Printf("error flushing tracer: %v", err)
+		}
+	}
+}
+
+func buildLightStepTracer() lightstep.Tracer {
+	if *argTransport != "http" && *argTransport != "grpc" {
+		log.Fatalf("unknown transport %q", *argTransport)
 	}
-	return lightstep.NewTracer(lightstep.Options{
+	options := lightstep.Options{
 		// Set this to your access token and switch the Collector and SystemMetrics
 		// entries below to report to Lightstep SaaS
 		AccessToken: "developer",
-		UseHttp:     true,
+		UseHttp:     *argTransport == "http",
+		UseGRPC:     *argTransport == "grpc",
 		Tags: map[string]interface{}{
 			lightstep.ComponentNameKey: "go_benchmark_service",
 		},
 		// Comment this entry and uncomment the next one to report to Lightstep SaaS
 		Collector: lightstep.Endpoint{
-			Host:      "localhost",
-			Port:      satellitePort,
-			Plaintext: true,
+			Host:             "localhost",
+			Port:             satellitePort,
+			Plaintext:        *argCACertFile == "",
+			CustomCACertFile: *argCACertFile,
 		},
 		//Collector: lightstep.Endpoint{
 		//	Host:      "ingest.lightstep.com",
 		//	Port:      443,
 		//	Plaintext: false,
 		//},
-		ReportingPeriod:    reportingPeriod,
-		MinReportingPeriod: minReportingPeriod,
-		MaxBufferedSpans:   maxBufferedSpans,
+		ReportingPeriod:    *argReportingPeriod,
+		MinReportingPeriod: *argMinReportingPeriod,
+		MaxBufferedSpans:   *argMaxBufferedSpans,
+		ReportTimeout:      *argReportTimeout,
+		MaxLogsPerSpan:     *argMaxLogsPerSpan,
+		DropSpanLogs:       *argDropSpanLogs != 0,
+		DialOptions:        grpcDialOptions(),
+
+		MetaEventReportingEnabled: *argMetaEventReporting != 0,
 		// Comment this entry and uncomment the next one to report to Lightstep SaaS
 		SystemMetrics: lightstep.SystemMetricsOptions{
+			Disabled:             *argDisableSystemMetrics != 0,
+			MeasurementFrequency: *argSystemMetricsFrequency,
 			Endpoint: lightstep.Endpoint{
-				Host:      "localhost",
-				Port:      8360,
-				Plaintext: true,
+				Host:             "localhost",
+				Port:             satellitePort,
+				Plaintext:        *argCACertFile == "",
+				CustomCACertFile: *argCACertFile,
 			},
 		},
 		//SystemMetrics: lightstep.SystemMetricsOptions{
@@ -111,11 +203,36 @@ func buildTracer() opentracing.Tracer {
 		//		Plaintext: false,
 		//	},
 		//},
-		UseGRPC: true,
-	})
+	}
+	if *argCACertFile != "" {
+		// the system metrics reporter posts with the default HTTP transport,
+		// which ignores CustomCACertFile
+		tlsConfig, err := loadCACert()
+		if err != nil {
+			log.Fatalf("unable to load CA certificate: %v", err)
+		}
+		http.DefaultTransport.(*http.Transport).TLSClientConfig = tlsConfig
+	}
+	if faultsEnabled() {
+		// lightstep only uses ConnFactory for gRPC connections
+		if *argTransport != "grpc" {
+			log.Fatalf("fault injection requires --transport grpc")
+		}
+		creds, err := faultTransportCredentials()
+		if err != nil {
+			log.Fatalf("unable to load collector credentials: %v", err)
+		}
+		address := fmt.Sprintf("%s:%d", options.Collector.Host, options.Collector.Port)
+		dialOptions := append([]grpc.DialOption{creds}, options.DialOptions...)
+		options.ConnFactory = newFaultInjector().connectorFactory(address, dialOptions...)
+	}
+	return lightstep.NewTracer(options)
 }
 
 func makeSpan(tracer opentracing.Tracer, parent opentracing.SpanContext) opentracing.Span {
+	if callLatencies != nil {
+		return makeTimedSpan(tracer, parent, callLatencies)
+	}
 	span := tracer.StartSpan("benchmark_test_service", opentracing.ChildOf(parent))
 	for i := 0; i < *argNumTags; i++ {
 		span.SetTag(tagKeys[i], tagVals[i])
@@ -127,9 +244,61 @@ func makeSpan(tracer opentracing.Tracer, parent opentracing.SpanContext) opentra
 	return span
 }
 
+// makeTimedSpan makes the same span as makeSpan, timing each call with
+// latencies.
+func makeTimedSpan(tracer opentracing.Tracer, parent opentracing.SpanContext, latencies *callLatency) opentracing.Span {
+	start := time.Now()
+	span := tracer.StartSpan("benchmark_test_service", opentracing.ChildOf(parent))
+	latencies.record(callStartSpan, start)
+	for i := 0; i < *argNumTags; i++ {
+		start = time.Now()
+		span.SetTag(tagKeys[i], tagVals[i])
+		latencies.record(callSetTag, start)
+	}
+	for i := 0; i < *argNumLogs; i++ {
+		start = time.Now()
+		span.LogFields(otlog.String(logKeys[i], logVals[i]))
+		latencies.record(callLogFields, start)
+	}
+	start = time.Now()
+	span.SetTag("trial", "alpha")
+	latencies.record(callSetTag, start)
+	return span
+}
+
+func finishSpan(span opentracing.Span) {
+	if callLatencies == nil {
+		span.Finish()
+		return
+	}
+	start := time.Now()
+	span.Finish()
+	callLatencies.record(callFinish, start)
+}
+
+// injectSpan propagates the span's context the way an outgoing HTTP request
+// would.
+func injectSpan(tracer opentracing.Tracer, span opentracing.Span) {
+	carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+	var start time.Time
+	if callLatencies != nil {
+		start = time.Now()
+	}
+	err := tracer.Inject(span.Context(), opentracing.HTTPHeaders, carrier)
+	if callLatencies != nil {
+		callLatencies.record(callInject, start)
+	}
+	if err != nil {
+		log.Fatalf("unable to inject span context: %v", err)
+	}
+}
+
 func generateSpans(tracer opentracing.Tracer, unitsWork int, numSpans int, parent opentracing.SpanContext) {
 	client_span := makeSpan(tracer, parent)
-	defer client_span.Finish()
+	defer finishSpan(client_span)
+	if *argInject != 0 {
+		injectSpan(tracer, client_span)
+	}
 	doWork(unitsWork)
 	numSpans -= 1
 	if numSpans == 0 {
@@ -137,7 +306,7 @@ func generateSpans(tracer opentracing.Tracer, unitsWork int, numSpans int, paren
 	}
 
 	server_span := makeSpan(tracer, client_span.Context())
-	defer server_span.Finish()
+	defer finishSpan(server_span)
 	doWork(unitsWork)
 	numSpans -= 1
 	if numSpans == 0 {
@@ -145,7 +314,7 @@ func generateSpans(tracer opentracing.Tracer, unitsWork int, numSpans int, paren
 	}
 
 	db_span := makeSpan(tracer, server_span.Context())
-	defer db_span.Finish()
+	defer finishSpan(db_span)
 	doWork(unitsWork)
 	numSpans -= 1
 	if numSpans == 0 {
@@ -155,28 +324,112 @@ func generateSpans(tracer opentracing.Tracer, unitsWork int, numSpans int, paren
 	generateSpans(tracer, unitsWork, numSpans, server_span.Context())
 }
 
-func performWork() {
-	tracer := buildTracer()
-
+// generateSpanLoop generates up to maxSpans spans at the pace set by --sleep
+// and --sleep_interval, stopping early at deadline unless it is zero. It
+// returns the number of spans generated.
+func generateSpanLoop(tracer opentracing.Tracer, maxSpans int, deadline time.Time) int {
 	sleepDebt := 0.0
 	spansSent := 0
-	for spansSent < *argRepeat {
-		spansToSend := min(*argRepeat-spansSent, spansPerLoop)
+	for spansSent < maxSpans && (deadline.IsZero() || time.Now().Before(deadline)) {
+		ctx, endTask := startLoopTask()
+		spansToSend := min(maxSpans-spansSent, spansPerLoop)
+		region := trace.StartRegion(ctx, "generateSpans")
 		generateSpans(tracer, *argWork, spansToSend, nil)
+		region.End()
 		spansSent += spansToSend
+		atomic.AddInt64(&spansGenerated, int64(spansToSend))
 		sleepDebt += *argSleep * float64(spansToSend)
 		if sleepDebt > float64(*argSleepInterval) {
 			sleepDebt -= float64(*argSleepInterval)
+			region = trace.StartRegion(ctx, "sleep")
+			sleepStart := time.Now()
 			time.Sleep(time.Duration(*argSleepInterval) * time.Nanosecond)
+			recordSleep(time.Duration(*argSleepInterval), sleepStart)
+			region.End()
 		}
+		endTask()
 	}
+	return spansSent
+}
+
+// warmUp generates spans for --warmup, then flushes them so that they reach
+// the satellites before measurement starts. It returns the number of spans
+// generated.
+func warmUp(tracer opentracing.Tracer) int {
+	spansSent := generateSpanLoop(tracer, math.MaxInt, time.Now().Add(*argWarmup))
+	flushTracer(context.Background(), tracer)
+	return spansSent
+}
+
+// startMeasuring tells the controller that the measured part of the test
+// starts now. Without a warmup the whole test is measured, so there's no
+// marker for the controller to act on.
+func startMeasuring() {
+	atomic.StoreInt32(&measuring, 1)
+	if *argWarmup > 0 {
+		printMarker(measurementStartedMarker, nil)
+	}
+}
+
+// performWork runs one test with the parameters in the command-line flags,
+// measuring it with measurement if it isn't nil. With --no_flush the tracer
+// is left open, and performWork returns a function which closes it; otherwise
+// the function does nothing.
+func performWork(measurement *selfMeasurement) func() {
+	// with --control_loop, calls made while warming up for this trial must
+	// not be timed in the previous trial's histograms
+	callLatencies = nil
+	tracer, closeTracer := buildTracer()
+	warmupSpans := 0
+	if *argWarmup > 0 {
+		warmupSpans = warmUp(tracer)
+	}
+	startMeasuring()
+	measurement.start()
+	// runtime statistics only cover the measured part of the test
+	stopRuntimeSampler := startRuntimeSampler()
+	defer stopRuntimeSampler()
+	if *argCallLatency != 0 {
+		callLatencies = newCallLatency()
+	}
+
+	stopExecutionTrace := startExecutionTrace()
+	defer stopExecutionTrace()
+
+	spansSent := generateSpanLoop(tracer, *argRepeat, time.Time{})
+	closeUnflushed := func() {}
 	if *argTrace != 0 && *argNoFlush != 1 {
-		tracer.(lightstep.Tracer).Close(context.Background())
+		shutdownTracer(closeTracer, warmupSpans+spansSent)
+	} else {
+		closeUnflushed = func() { closeTracer(context.Background()) }
+	}
+	measurement.stop(spansSent)
+	if tracerEvents != nil {
+		tracerEvents.write(warmupSpans + spansSent)
 	}
+	if callLatencies != nil {
+		callLatencies.write()
+	}
+	return closeUnflushed
 }
 
 func main() {
 	flag.Parse()
 	setupAnnotations()
-	performWork()
+	stopProfiling := startProfiling()
+	defer stopProfiling()
+	startMetricsServer()
+	if *argControlURL != "" {
+		runControlLoop()
+		return
+	}
+	var measurement *selfMeasurement
+	if *argResultFile != "" {
+		measurement = &selfMeasurement{}
+	}
+	// the process exits without closing a tracer left open by --no_flush
+	performWork(measurement)
+	if measurement != nil {
+		measurement.write(*argResultFile)
+	}
 }
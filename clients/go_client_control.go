@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+var argControlURL = flag.String("control_url", "", "If set, fetch the test parameters from this control server URL instead of the command-line flags")
+var argResultURL = flag.String("result_url", "", "The URL to POST test results to (the control URL's /result path if empty)")
+var argControlLoop = flag.Int("control_loop", 0, "Whether to keep fetching and running tests until the control server has none left")
+
+// controlMessage holds the parameters of a test, as described in
+// docs/adding_tracers.md.
+type controlMessage struct {
+	Trace         bool
+	Sleep         float64
+	SleepInterval int
+	Work          int
+	Repeat        int
+	NoFlush       bool
+}
+
+// apply sets the command-line flags which performWork reads from the
+// message.
+func (c *controlMessage) apply() {
+	*argTrace = boolToInt(c.Trace)
+	*argSleep = c.Sleep
+	*argSleepInterval = c.SleepInterval
+	*argWork = c.Work
+	*argRepeat = c.Repeat
+	*argNoFlush = boolToInt(c.NoFlush)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fetchControlMessage returns the next test to run, or nil when the control
+// server responds with 204 No Content because there are no tests left.
+func fetchControlMessage(controlURL string) (*controlMessage, error) {
+	resp, err := http.Get(controlURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var message controlMessage
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func postResults(resultURL string, results map[string]interface{}) error {
+	body, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(resultURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// resultURL returns --result_url, or the control URL with its path replaced
+// by /result.
+func resultURL() string {
+	if *argResultURL != "" {
+		return *argResultURL
+	}
+	u, err := url.Parse(*argControlURL)
+	if err != nil {
+		log.Fatalf("invalid control URL %q: %v", *argControlURL, err)
+	}
+	u.Path = "/result"
+	u.RawQuery = ""
+	return u.String()
+}
+
+// runControlLoop runs the tests handed out by the control server at
+// --control_url and posts the measured results of each one back. With
+// --control_loop, one process runs every test until the server has none
+// left, so that trials don't pay for starting a new process.
+func runControlLoop() {
+	resultURL := resultURL()
+	for {
+		message, err := fetchControlMessage(*argControlURL)
+		if err != nil {
+			log.Fatalf("unable to fetch control message: %v", err)
+		}
+		if message == nil {
+			return
+		}
+		message.apply()
+		measurement := &selfMeasurement{}
+		closeUnflushed := performWork(measurement)
+		if err := postResults(resultURL, measurement.toMap()); err != nil {
+			log.Fatalf("unable to post results: %v", err)
+		}
+		// a tracer left open by NoFlush is closed once the trial's results
+		// are in, so that it doesn't keep reporting during the next trial.
+		// The control server resets the satellites before handing out the
+		// next test, so the spans it flushes aren't counted.
+		closeUnflushed()
+		if *argControlLoop == 0 {
+			return
+		}
+	}
+}
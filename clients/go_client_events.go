@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lightstep/lightstep-tracer-go"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var argEventSummaryFile = flag.String("event_summary_file", "", "Where to write the tracer event summary (stdout if empty)")
+
+// flushErrorCauses gives each flush error state a short machine-readable name.
+var flushErrorCauses = map[lightstep.EventFlushErrorState]string{
+	lightstep.FlushErrorTracerClosed:   "TracerClosed",
+	lightstep.FlushErrorTracerDisabled: "TracerDisabled",
+	lightstep.FlushErrorTransport:      "Transport",
+	lightstep.FlushErrorReport:         "Report",
+	lightstep.FlushErrorTranslate:      "Translate",
+}
+
+// eventSummary aggregates the events emitted by the lightstep tracer.
+type eventSummary struct {
+	mutex sync.Mutex
+
+	statusReports     int
+	sentSpans         int
+	droppedSpans      int
+	encodingErrors    int
+	flushErrors       map[string]int
+	connectionErrors  int
+	unsupportedValues int
+	flushDurations    []time.Duration
+
+	// A failed flush emits an EventFlushError followed by an EventStatusReport
+	// whose dropped spans are carried over into the next report, so only the
+	// duration of that status report is counted.
+	flushFailed bool
+	// lastFlushError is the cause of the last flush if it failed, or empty if
+	// it succeeded
+	lastFlushError string
+	// translateErrors is whether any flush failed to translate its spans,
+	// which the tracer then discards
+	translateErrors bool
+
+	loggedErrors map[string]bool
+}
+
+func newEventSummary() *eventSummary {
+	return &eventSummary{
+		flushErrors:  make(map[string]int),
+		loggedErrors: make(map[string]bool),
+	}
+}
+
+// install makes the summary the lightstep tracer's global event handler.
+func (s *eventSummary) install() {
+	lightstep.SetGlobalEventHandler(s.handle)
+}
+
+func (s *eventSummary) handle(event lightstep.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch e := event.(type) {
+	case lightstep.EventStatusReport:
+		s.flushDurations = append(s.flushDurations, e.FlushDuration())
+		if s.flushFailed {
+			s.flushFailed = false
+			return
+		}
+		s.lastFlushError = ""
+		s.statusReports++
+		s.sentSpans += e.SentSpans()
+		s.droppedSpans += e.DroppedSpans()
+		s.encodingErrors += e.EncodingErrors()
+	case lightstep.EventFlushError:
+		cause, ok := flushErrorCauses[e.State()]
+		if !ok {
+			cause = string(e.State())
+		}
+		s.flushErrors[cause]++
+		s.lastFlushError = cause
+		if e.State() == lightstep.FlushErrorTranslate {
+			s.translateErrors = true
+		}
+		// flushes rejected before they start are not followed by a status report
+		if e.State() != lightstep.FlushErrorTracerClosed && e.State() != lightstep.FlushErrorTracerDisabled {
+			s.flushFailed = true
+		}
+		s.logFirst("FlushError"+cause, e)
+	case lightstep.EventConnectionError:
+		s.connectionErrors++
+		s.logFirst("ConnectionError", e)
+	case lightstep.EventUnsupportedValue:
+		s.unsupportedValues++
+		s.logFirst("UnsupportedValue", e)
+	case lightstep.ErrorEvent:
+		s.logFirst(fmt.Sprintf("%T", e), e)
+	}
+}
+
+// logFirst logs the first event of each kind, much like the tracer's default
+// event handler logs the first error.
+func (s *eventSummary) logFirst(kind string, event lightstep.Event) {
+	if s.loggedErrors[kind] {
+		return
+	}
+	s.loggedErrors[kind] = true
+	log.Printf("LS Tracer event: %v", event)
+}
+
+// spanCounts returns the spans sent and dropped so far.
+func (s *eventSummary) spanCounts() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sentSpans, s.droppedSpans
+}
+
+// unreportedSpans returns how many of the generated spans haven't been sent
+// or dropped according to the status reports so far, ie. how many are still
+// buffered or in a report which is being sent.
+func (s *eventSummary) unreportedSpans(generated int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return generated - s.sentSpans - s.droppedSpans
+}
+
+// percentile returns the value at or below which p percent of the sorted
+// durations fall.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// droppedByCause breaks down the generated spans which weren't sent. The
+// status reports only count spans dropped because the buffer was full; the
+// rest are inferred to have been lost with the failed flush at close, or
+// else discarded after failing to translate. Spans which are unaccounted for
+// otherwise are counted as "Unreported".
+func (s *eventSummary) droppedByCause(generated int) map[string]int {
+	dropped := map[string]int{"BufferFull": s.droppedSpans}
+	lost := generated - s.sentSpans - s.droppedSpans
+	if lost <= 0 {
+		return dropped
+	}
+	switch {
+	case s.lastFlushError != "":
+		dropped[s.lastFlushError] = lost
+	case s.translateErrors:
+		dropped["Translate"] = lost
+	default:
+		dropped["Unreported"] = lost
+	}
+	return dropped
+}
+
+// toMap returns the summary given the number of spans generated during the
+// test. Flush durations include failed flushes.
+func (s *eventSummary) toMap(generated int) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	durations := append([]time.Duration(nil), s.flushDurations...)
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	flushDuration := map[string]float64{"Count": float64(len(durations))}
+	for name, p := range map[string]float64{"P50": 50, "P90": 90, "P99": 99, "Max": 100} {
+		flushDuration[name] = percentile(durations, p).Seconds()
+	}
+	return map[string]interface{}{
+		"StatusReports":     s.statusReports,
+		"SentSpans":         s.sentSpans,
+		"DroppedSpans":      s.droppedByCause(generated),
+		"EncodingErrors":    s.encodingErrors,
+		"FlushErrors":       s.flushErrors,
+		"ConnectionErrors":  s.connectionErrors,
+		"UnsupportedValues": s.unsupportedValues,
+		"FlushDuration":     flushDuration,
+	}
+}
+
+// write outputs the summary as a single line of JSON.
+func (s *eventSummary) write(generated int) {
+	out := os.Stdout
+	if *argEventSummaryFile != "" {
+		file, err := os.Create(*argEventSummaryFile)
+		if err != nil {
+			log.Printf("unable to write event summary: %v", err)
+			return
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := json.NewEncoder(out).Encode(map[string]interface{}{"TracerEvents": s.toMap(generated)}); err != nil {
+		log.Printf("unable to write event summary: %v", err)
+	}
+}
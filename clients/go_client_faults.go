@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	"github.com/lightstep/lightstep-tracer-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var argFaultBandwidth = flag.Int("fault_bandwidth", 0, "Limit the collector connection to this many bytes per second in each direction")
+var argFaultLatency = flag.Duration("fault_latency", 0, "Latency added to the delivery of each write on the collector connection")
+var argFaultJitter = flag.Duration("fault_jitter", 0, "Maximum random deviation from --fault_latency")
+var argFaultStallProbability = flag.Float64("fault_stall_probability", 0, "Probability that a write on the collector connection stalls")
+var argFaultStallDuration = flag.Duration("fault_stall_duration", time.Second, "How long a stalled write is held back")
+var argFaultResetProbability = flag.Float64("fault_reset_probability", 0, "Probability that a write resets the collector connection")
+var argFaultSeed = flag.Int64("fault_seed", 1, "Seed for the fault injection random number generator")
+
+var errFaultConnectionReset = errors.New("fault injection: connection reset")
+
+func faultsEnabled() bool {
+	return *argFaultBandwidth > 0 || *argFaultLatency > 0 || *argFaultJitter > 0 ||
+		*argFaultStallProbability > 0 || *argFaultResetProbability > 0
+}
+
+// faultInjector decides how each write to the collector is delayed or
+// failed. A single seeded random number generator is shared by all of its
+// connections so that a scenario replays identically from run to run.
+type faultInjector struct {
+	bandwidth        int
+	latency          time.Duration
+	jitter           time.Duration
+	stallProbability float64
+	stallDuration    time.Duration
+	resetProbability float64
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newFaultInjector() *faultInjector {
+	return &faultInjector{
+		bandwidth:        *argFaultBandwidth,
+		latency:          *argFaultLatency,
+		jitter:           *argFaultJitter,
+		stallProbability: *argFaultStallProbability,
+		stallDuration:    *argFaultStallDuration,
+		resetProbability: *argFaultResetProbability,
+		rand:             rand.New(rand.NewSource(*argFaultSeed)),
+	}
+}
+
+// transferTime returns how long n bytes take to cross the connection at the
+// configured bandwidth.
+func (f *faultInjector) transferTime(n int) time.Duration {
+	if f.bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second / time.Duration(f.bandwidth)
+}
+
+// nextWrite returns how long the delivery of a write should be delayed, on
+// top of its transfer time, and whether it should reset the connection
+// instead.
+func (f *faultInjector) nextWrite() (time.Duration, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.rand.Float64() < f.resetProbability {
+		return 0, true
+	}
+	delay := f.latency
+	if f.jitter > 0 {
+		delay += time.Duration((2*f.rand.Float64() - 1) * float64(f.jitter))
+	}
+	if f.rand.Float64() < f.stallProbability {
+		delay += f.stallDuration
+	}
+	return delay, false
+}
+
+func (f *faultInjector) dial(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newFaultConn(conn, f), nil
+}
+
+// connectorFactory returns a lightstep.ConnectorFactory which dials the
+// collector over gRPC through fault-injecting connections.
+func (f *faultInjector) connectorFactory(address string, dialOptions ...grpc.DialOption) lightstep.ConnectorFactory {
+	return func() (interface{}, lightstep.Connection, error) {
+		options := append([]grpc.DialOption{grpc.WithContextDialer(f.dial)}, dialOptions...)
+		conn, err := grpc.Dial(address, options...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return collectorpb.NewCollectorServiceClient(conn), conn, nil
+	}
+}
+
+// faultConn injects faults into a collector connection. Writes are held back
+// for their transfer time, which throttles the connection like a slow link.
+// Latency, jitter and stalls only delay when each write is delivered, like
+// a long link, so later writes aren't held back by them except to keep
+// writes in order.
+type faultConn struct {
+	net.Conn
+	injector *faultInjector
+
+	// writes are delivered in order by deliver
+	writes    chan delayedWrite
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mutex sync.Mutex
+	// lastDue is when the last write queued will be delivered
+	lastDue time.Time
+	// err is the error the last delivered write failed with
+	err error
+}
+
+type delayedWrite struct {
+	b   []byte
+	due time.Time
+}
+
+func newFaultConn(conn net.Conn, injector *faultInjector) *faultConn {
+	c := &faultConn{
+		Conn:     conn,
+		injector: injector,
+		writes:   make(chan delayedWrite, 1024),
+		closed:   make(chan struct{}),
+	}
+	go c.deliver()
+	return c
+}
+
+func (c *faultConn) Write(b []byte) (int, error) {
+	delay, reset := c.injector.nextWrite()
+	if reset {
+		c.Close()
+		return 0, errFaultConnectionReset
+	}
+	time.Sleep(c.injector.transferTime(len(b)))
+
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return 0, c.err
+	}
+	due := time.Now().Add(delay)
+	if due.Before(c.lastDue) {
+		due = c.lastDue
+	}
+	c.lastDue = due
+	c.mutex.Unlock()
+
+	// b may be reused once Write returns
+	write := delayedWrite{b: append([]byte(nil), b...), due: due}
+	select {
+	case c.writes <- write:
+		return len(b), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (c *faultConn) deliver() {
+	for {
+		select {
+		case write := <-c.writes:
+			time.Sleep(time.Until(write.due))
+			if _, err := c.Conn.Write(write.b); err != nil {
+				c.mutex.Lock()
+				c.err = err
+				c.mutex.Unlock()
+				c.Close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *faultConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+func (c *faultConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	time.Sleep(c.injector.transferTime(n))
+	return n, err
+}
+
+// faultTransportCredentials returns the credentials the fault-injecting
+// connector dials the collector with, since lightstep only applies its own
+// credentials when it dials the connection itself.
+func faultTransportCredentials() (grpc.DialOption, error) {
+	if *argCACertFile == "" {
+		return grpc.WithTransportCredentials(insecure.NewCredentials()), nil
+	}
+	creds, err := credentials.NewClientTLSFromFile(*argCACertFile, "")
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(creds), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"time"
+)
+
+var argGRPCGzip = flag.Int("grpc_gzip", 0, "Whether to gzip compress gRPC reports")
+var argGRPCInitialWindowSize = flag.Int("grpc_initial_window_size", 0, "The gRPC per-stream flow control window in bytes (0 uses the gRPC default)")
+var argGRPCInitialConnWindowSize = flag.Int("grpc_initial_conn_window_size", 0, "The gRPC per-connection flow control window in bytes (0 uses the gRPC default)")
+var argGRPCReadBufferSize = flag.Int("grpc_read_buffer_size", -1, "The gRPC connection read buffer size in bytes (-1 uses the gRPC default)")
+var argGRPCWriteBufferSize = flag.Int("grpc_write_buffer_size", -1, "The gRPC connection write buffer size in bytes (-1 uses the gRPC default)")
+var argGRPCKeepaliveTime = flag.Duration("grpc_keepalive_time", 0, "How long the gRPC connection may be idle before it is pinged (0 disables keepalive)")
+var argGRPCKeepaliveTimeout = flag.Duration("grpc_keepalive_timeout", 20*time.Second, "How long to wait for a keepalive ping to be acknowledged")
+var argGRPCKeepalivePermitWithoutStream = flag.Int("grpc_keepalive_permit_without_stream", 0, "Whether to send keepalive pings when no report is in flight")
+
+// grpcDialOptions returns the dial options selected by the --grpc_* flags.
+// Unset flags add no option, so gRPC's defaults apply.
+func grpcDialOptions() []grpc.DialOption {
+	var options []grpc.DialOption
+	if *argGRPCGzip != 0 {
+		options = append(options, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+	if *argGRPCInitialWindowSize > 0 {
+		options = append(options, grpc.WithInitialWindowSize(int32(*argGRPCInitialWindowSize)))
+	}
+	if *argGRPCInitialConnWindowSize > 0 {
+		options = append(options, grpc.WithInitialConnWindowSize(int32(*argGRPCInitialConnWindowSize)))
+	}
+	if *argGRPCReadBufferSize >= 0 {
+		options = append(options, grpc.WithReadBufferSize(*argGRPCReadBufferSize))
+	}
+	if *argGRPCWriteBufferSize >= 0 {
+		options = append(options, grpc.WithWriteBufferSize(*argGRPCWriteBufferSize))
+	}
+	if *argGRPCKeepaliveTime > 0 {
+		options = append(options, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                *argGRPCKeepaliveTime,
+			Timeout:             *argGRPCKeepaliveTimeout,
+			PermitWithoutStream: *argGRPCKeepalivePermitWithoutStream != 0,
+		}))
+	}
+	return options
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"time"
+)
+
+var argCallLatency = flag.Int("call_latency", 0, "Whether to time each OpenTracing API call and print latency percentiles at exit")
+var argCallLatencyFile = flag.String("call_latency_file", "", "Where to write the call latency summary (stdout if empty)")
+
+// The OpenTracing API calls which are timed.
+const (
+	callStartSpan = iota
+	callSetTag
+	callLogFields
+	callFinish
+	callInject
+	numCalls
+)
+
+var callNames = [numCalls]string{"StartSpan", "SetTag", "LogFields", "Finish", "Inject"}
+
+// The histogram keeps 2^latencySubBucketBits sub-buckets for each power of
+// two, so recorded values are accurate to within 1/64 (about 1.6%).
+const (
+	latencySubBucketBits  = 6
+	latencySubBucketCount = 1 << latencySubBucketBits
+	latencyBucketCount    = (64-latencySubBucketBits)*latencySubBucketCount + latencySubBucketCount
+)
+
+// latencyHistogram is a log-linear histogram of nanosecond durations in the
+// style of an HDR histogram.
+type latencyHistogram struct {
+	counts [latencyBucketCount]uint64
+	total  uint64
+	max    int64
+}
+
+// latencyIndex returns the bucket v is counted in. Values below twice the
+// sub-bucket count are counted exactly; larger values are shifted so that
+// their top latencySubBucketBits+1 bits select the bucket.
+func latencyIndex(v int64) int {
+	shift := bits.Len64(uint64(v)) - latencySubBucketBits - 1
+	if shift < 0 {
+		shift = 0
+	}
+	return shift*latencySubBucketCount + int(v>>uint(shift))
+}
+
+// latencyValue returns the largest value counted in bucket index.
+func latencyValue(index int) int64 {
+	shift := index/latencySubBucketCount - 1
+	if shift < 0 {
+		shift = 0
+	}
+	lower := int64(index-shift*latencySubBucketCount) << uint(shift)
+	return lower + (int64(1) << uint(shift)) - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	h.counts[latencyIndex(v)]++
+	h.total++
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// percentile returns the value at or below which p percent of the recorded
+// values fall.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if p >= 100 {
+		return time.Duration(h.max)
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+	seen := uint64(0)
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			if v := latencyValue(i); v < h.max {
+				return time.Duration(v)
+			}
+			return time.Duration(h.max)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// callLatency times OpenTracing API calls. callLatencies is nil when
+// --call_latency is off, and the span loop then skips timing altogether.
+// generateSpans runs on a single goroutine, so no locking is needed.
+type callLatency struct {
+	histograms [numCalls]latencyHistogram
+
+	// the cost of reading the clock twice, subtracted from every sample
+	timerOverhead time.Duration
+}
+
+var callLatencies *callLatency = nil
+
+func newCallLatency() *callLatency {
+	return &callLatency{timerOverhead: measureTimerOverhead()}
+}
+
+// measureTimerOverhead returns the median cost of timing an empty call.
+func measureTimerOverhead() time.Duration {
+	const samples = 10001
+	overheads := make([]time.Duration, samples)
+	for i := range overheads {
+		start := time.Now()
+		overheads[i] = time.Since(start)
+	}
+	sort.Slice(overheads, func(i, j int) bool { return overheads[i] < overheads[j] })
+	return overheads[samples/2]
+}
+
+func (c *callLatency) record(call int, start time.Time) {
+	c.histograms[call].record(time.Since(start) - c.timerOverhead)
+}
+
+func (c *callLatency) toMap() map[string]interface{} {
+	calls := make(map[string]interface{}, numCalls)
+	for call, name := range callNames {
+		h := &c.histograms[call]
+		if h.total == 0 {
+			continue
+		}
+		summary := map[string]float64{"Count": float64(h.total)}
+		for label, p := range map[string]float64{"P50": 50, "P90": 90, "P99": 99, "P99.9": 99.9, "Max": 100} {
+			summary[label] = h.percentile(p).Seconds()
+		}
+		calls[name] = summary
+	}
+	return map[string]interface{}{
+		"Calls":         calls,
+		"TimerOverhead": c.timerOverhead.Seconds(),
+	}
+}
+
+// write outputs the summary as a single line of JSON.
+func (c *callLatency) write() {
+	out := os.Stdout
+	if *argCallLatencyFile != "" {
+		file, err := os.Create(*argCallLatencyFile)
+		if err != nil {
+			log.Printf("unable to write call latency summary: %v", err)
+			return
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := json.NewEncoder(out).Encode(map[string]interface{}{"CallLatency": c.toMap()}); err != nil {
+		log.Printf("unable to write call latency summary: %v", err)
+	}
+}
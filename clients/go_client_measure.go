@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var argResultFile = flag.String("result_file", "", "If set, measure the client's own CPU and memory use and write the results to this file as JSON")
+
+// selfMeasurement measures the CPU time, wall time and resident memory of the
+// client from inside the process, so that process startup isn't counted. The
+// results match the fields read by `Result.from_dict` in
+// benchmark/controller.py.
+type selfMeasurement struct {
+	startClock  time.Time
+	startCPU    time.Duration
+	spansSent   int
+	programTime time.Duration
+	clockTime   time.Duration
+
+	mutex      sync.Mutex
+	cpuList    []float64
+	memoryList []int64
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// start begins measuring. Like stop, it does nothing on a nil receiver, so
+// performWork can be run without measuring itself.
+func (m *selfMeasurement) start() {
+	if m == nil {
+		return
+	}
+	m.startClock = time.Now()
+	m.startCPU = cpuTime(getRusage())
+	m.cpuList = []float64{}
+	m.memoryList = []int64{}
+	m.done = make(chan struct{})
+	m.stopped = make(chan struct{})
+	go m.run()
+}
+
+func getRusage() *syscall.Rusage {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		log.Fatalf("unable to read resource usage: %v", err)
+	}
+	return &usage
+}
+
+// cpuTime returns the user plus system CPU time used by the process.
+func cpuTime(usage *syscall.Rusage) time.Duration {
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// residentMemory returns the resident set size of the process in bytes.
+func residentMemory(usage *syscall.Rusage) int64 {
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) > 1 {
+			if pages, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				return pages * int64(os.Getpagesize())
+			}
+		}
+	}
+	// without procfs (eg. on macOS) fall back to the peak resident set size,
+	// which macOS reports in bytes but Linux reports in kilobytes
+	if runtime.GOOS == "darwin" {
+		return usage.Maxrss
+	}
+	return usage.Maxrss * 1024
+}
+
+// run samples CPU use and resident memory once a second, like
+// `ClientProcess._save_list_stats` does from outside the process.
+func (m *selfMeasurement) run() {
+	defer close(m.stopped)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastClock := m.startClock
+	lastCPU := m.startCPU
+	for {
+		select {
+		case now := <-ticker.C:
+			usage := getRusage()
+			cpu := cpuTime(usage)
+			m.mutex.Lock()
+			m.cpuList = append(m.cpuList, float64(cpu-lastCPU)/float64(now.Sub(lastClock)))
+			m.memoryList = append(m.memoryList, residentMemory(usage))
+			m.mutex.Unlock()
+			lastClock = now
+			lastCPU = cpu
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// stop ends measuring.
+func (m *selfMeasurement) stop(spansSent int) {
+	if m == nil {
+		return
+	}
+	m.programTime = cpuTime(getRusage()) - m.startCPU
+	m.clockTime = time.Since(m.startClock)
+	close(m.done)
+	<-m.stopped
+	m.spansSent = spansSent
+}
+
+func (m *selfMeasurement) toMap() map[string]interface{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return map[string]interface{}{
+		"SpansSent":   m.spansSent,
+		"ProgramTime": m.programTime.Seconds(),
+		"ClockTime":   m.clockTime.Seconds(),
+		"CPUList":     m.cpuList,
+		"MemoryList":  m.memoryList,
+	}
+}
+
+// write outputs the results to filename as JSON.
+func (m *selfMeasurement) write(filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Printf("unable to write results: %v", err)
+		return
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(m.toMap()); err != nil {
+		log.Printf("unable to write results: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var argMetricsPort = flag.Int("metrics_port", 0, "If set, serve live progress as Prometheus metrics on this loopback port")
+
+// Progress counters exposed on /metrics. They are updated with atomic
+// operations so that the span generation loop doesn't take a lock.
+var spansGenerated int64 = 0
+var sleepLagNanos int64 = 0
+var measuring int32 = 0
+
+// liveEvents holds the *eventSummary of the current test, if any, for the
+// metrics server's goroutine.
+var liveEvents atomic.Value
+
+// recordSleep adds how much longer a pacing sleep took than requested to the
+// pacing lag.
+func recordSleep(requested time.Duration, start time.Time) {
+	if lag := time.Since(start) - requested; lag > 0 {
+		atomic.AddInt64(&sleepLagNanos, int64(lag))
+	}
+}
+
+// startMetricsServer serves /metrics on --metrics_port if it is set.
+func startMetricsServer() {
+	if *argMetricsPort == 0 {
+		return
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(*argMetricsPort)))
+	if err != nil {
+		log.Fatalf("unable to serve metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
+}
+
+// serveMetrics writes the metrics in the Prometheus text exposition format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "go_client_spans_generated_total", "counter", "Spans generated, including warmup", float64(atomic.LoadInt64(&spansGenerated)))
+	writeMetric(w, "go_client_measuring", "gauge", "Whether warmup is over and the test is being measured", float64(atomic.LoadInt32(&measuring)))
+	writeMetric(w, "go_client_pacing_lag_seconds_total", "counter", "Time pacing sleeps overran the requested sleep interval", time.Duration(atomic.LoadInt64(&sleepLagNanos)).Seconds())
+	if events, _ := liveEvents.Load().(*eventSummary); events != nil {
+		sent, dropped := events.spanCounts()
+		writeMetric(w, "go_client_tracer_spans_sent_total", "counter", "Spans the tracer reported sending", float64(sent))
+		writeMetric(w, "go_client_tracer_spans_dropped_total", "counter", "Spans the tracer reported dropping", float64(dropped))
+	}
+	writeMetric(w, "go_client_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans", float64(stats.HeapInuse))
+	writeMetric(w, "go_client_goroutines", "gauge", "Number of goroutines", float64(runtime.NumGoroutine()))
+}
+
+func writeMetric(w http.ResponseWriter, name string, kind string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
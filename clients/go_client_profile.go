@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+var argCPUProfile = flag.String("cpuprofile", "", "If set, write a CPU profile of the run to this file")
+var argMemProfile = flag.String("memprofile", "", "If set, write a heap profile to this file at exit")
+var argMemProfileRate = flag.Int("memprofile_rate", 0, "Sample one allocation per this many bytes in the heap profile (0 uses the runtime default)")
+var argMutexProfile = flag.String("mutexprofile", "", "If set, write a mutex contention profile to this file at exit")
+var argMutexProfileFraction = flag.Int("mutexprofile_fraction", 1, "Sample 1 in this many mutex contention events")
+var argBlockProfile = flag.String("blockprofile", "", "If set, write a goroutine blocking profile to this file at exit")
+var argBlockProfileRate = flag.Int("blockprofile_rate", 1, "Sample one blocking event per this many nanoseconds blocked")
+
+// startProfiling starts the profiles selected by the --*profile flags and
+// returns a function which stops them and writes them out.
+func startProfiling() func() {
+	if *argMemProfile != "" && *argMemProfileRate > 0 {
+		runtime.MemProfileRate = *argMemProfileRate
+	}
+	if *argMutexProfile != "" {
+		runtime.SetMutexProfileFraction(*argMutexProfileFraction)
+	}
+	if *argBlockProfile != "" {
+		runtime.SetBlockProfileRate(*argBlockProfileRate)
+	}
+	var cpuProfile *os.File
+	if *argCPUProfile != "" {
+		file, err := os.Create(*argCPUProfile)
+		if err != nil {
+			log.Fatalf("unable to create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			log.Fatalf("unable to start CPU profile: %v", err)
+		}
+		cpuProfile = file
+	}
+
+	return func() {
+		if cpuProfile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuProfile.Close(); err != nil {
+				log.Printf("unable to write CPU profile: %v", err)
+			}
+		}
+		if *argMemProfile != "" {
+			// collect garbage so the profile reflects live objects
+			runtime.GC()
+			writeProfile("heap", *argMemProfile)
+		}
+		if *argMutexProfile != "" {
+			writeProfile("mutex", *argMutexProfile)
+		}
+		if *argBlockProfile != "" {
+			writeProfile("block", *argBlockProfile)
+		}
+	}
+}
+
+// writeProfile writes the named runtime/pprof profile to filename.
+func writeProfile(name string, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Printf("unable to write %s profile: %v", name, err)
+		return
+	}
+	defer file.Close()
+	if err := pprof.Lookup(name).WriteTo(file, 0); err != nil {
+		log.Printf("unable to write %s profile: %v", name, err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var argRuntimeStatsFile = flag.String("runtime_stats_file", "", "If set, write a JSON line of Go runtime statistics to this file every --runtime_stats_interval")
+var argRuntimeStatsInterval = flag.Duration("runtime_stats_interval", time.Second, "How often Go runtime statistics are sampled")
+
+// runtimeSample is one line of the runtime statistics stream. Rates, GC
+// counts and pause times cover the interval since the previous sample.
+type runtimeSample struct {
+	Time            float64
+	HeapInUse       uint64
+	AllocsPerSecond float64
+	BytesPerSecond  float64
+	NumGC           uint32
+	GCPauseSeconds  float64
+	NumGoroutine    int
+	// NumThreads is the number of OS threads the process is running, or 0
+	// where /proc/self/status can't be read
+	NumThreads int
+}
+
+// runtimeSampler periodically samples runtime.MemStats and writes each
+// sample as a line of JSON.
+type runtimeSampler struct {
+	encoder *json.Encoder
+	file    *os.File
+	start   time.Time
+	last    runtime.MemStats
+	lastAt  time.Time
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newRuntimeSampler(path string) (*runtimeSampler, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &runtimeSampler{
+		encoder: json.NewEncoder(file),
+		file:    file,
+		start:   time.Now(),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	runtime.ReadMemStats(&s.last)
+	s.lastAt = s.start
+	return s, nil
+}
+
+func (s *runtimeSampler) run(interval time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sample()
+		case <-s.done:
+			s.sample()
+			return
+		}
+	}
+}
+
+func (s *runtimeSampler) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	now := time.Now()
+	elapsed := now.Sub(s.lastAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	sample := runtimeSample{
+		Time:            now.Sub(s.start).Seconds(),
+		HeapInUse:       stats.HeapInuse,
+		AllocsPerSecond: float64(stats.Mallocs-s.last.Mallocs) / elapsed,
+		BytesPerSecond:  float64(stats.TotalAlloc-s.last.TotalAlloc) / elapsed,
+		NumGC:           stats.NumGC - s.last.NumGC,
+		GCPauseSeconds:  time.Duration(stats.PauseTotalNs - s.last.PauseTotalNs).Seconds(),
+		NumGoroutine:    runtime.NumGoroutine(),
+		NumThreads:      numThreads(),
+	}
+	s.last = stats
+	s.lastAt = now
+	if err := s.encoder.Encode(sample); err != nil {
+		log.Printf("unable to write runtime stats: %v", err)
+	}
+}
+
+// numThreads returns the number of OS threads in the process according to
+// the Threads line of /proc/self/status, or 0 if it can't be read. Unlike the
+// threadcreate profile, this counts threads which are running now rather
+// than all the threads ever created.
+func numThreads() int {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value := strings.TrimPrefix(line, "Threads:"); value != line {
+			threads, _ := strconv.Atoi(strings.TrimSpace(value))
+			return threads
+		}
+	}
+	return 0
+}
+
+// stop takes a final sample and closes the stream.
+func (s *runtimeSampler) stop() {
+	close(s.done)
+	<-s.stopped
+	if err := s.file.Close(); err != nil {
+		log.Printf("unable to write runtime stats: %v", err)
+	}
+}
+
+// startRuntimeSampler starts sampling if --runtime_stats_file is set and
+// returns a function which stops it.
+func startRuntimeSampler() func() {
+	if *argRuntimeStatsFile == "" {
+		return func() {}
+	}
+	sampler, err := newRuntimeSampler(*argRuntimeStatsFile)
+	if err != nil {
+		log.Fatalf("unable to create runtime stats file: %v", err)
+	}
+	go sampler.run(*argRuntimeStatsInterval)
+	return sampler.stop
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+var argCloseTimeout = flag.Duration("close_timeout", 0, "The deadline for flushing and closing the tracer (0 waits as long as the tracer takes)")
+
+// The controller reconciles the spans buffered at shutdown with the spans the
+// satellites receive between the lines of JSON printed with these keys.
+const (
+	shutdownStartedMarker  = "ShutdownStarted"
+	shutdownFinishedMarker = "ShutdownFinished"
+)
+
+// printMarker prints a line of JSON which tells the controller the client
+// has reached a point in the test. The marker's key holds the current time.
+func printMarker(marker string, fields map[string]interface{}) {
+	line := map[string]interface{}{marker: float64(time.Now().UnixNano()) / 1e9}
+	for key, value := range fields {
+		line[key] = value
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(line); err != nil {
+		log.Printf("unable to print %s: %v", marker, err)
+	}
+}
+
+// shutdownTracer closes the tracer within --close_timeout and times it.
+// generated is the number of spans created during the test, which the
+// LightStep tracer's status reports are compared with to estimate the spans
+// still buffered when shutdown starts.
+func shutdownTracer(closeTracer func(context.Context), generated int) {
+	started := map[string]interface{}{}
+	if tracerEvents != nil {
+		// the tracer doesn't expose its buffer, so this is an upper bound:
+		// it holds at most a full buffer and a full report being sent, so
+		// spans beyond those were dropped but not reported yet
+		started["EstimatedBufferedSpans"] = min(tracerEvents.unreportedSpans(generated), 2**argMaxBufferedSpans)
+	}
+	printMarker(shutdownStartedMarker, started)
+
+	ctx := context.Background()
+	if *argCloseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *argCloseTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	closeTracer(ctx)
+	closeTime := time.Since(start)
+
+	printMarker(shutdownFinishedMarker, map[string]interface{}{
+		"CloseTime":     closeTime.Seconds(),
+		"CloseTimedOut": ctx.Err() != nil,
+	})
+}
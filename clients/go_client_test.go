@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"github.com/lightstep/lightstep-tracer-go"
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel"
+	"runtime"
+	"testing"
+)
+
+// benchmarkTags and benchmarkLogs match the annotations the controller asks
+// clients to set on each span.
+const (
+	benchmarkTags = 10
+	benchmarkLogs = 15
+)
+
+// tracerVariants maps each tracer go_client can benchmark to the --trace and
+// --traceR flags which select it.
+var tracerVariants = []struct {
+	name   string
+	trace  int
+	tracer string
+}{
+	{"noop", 0, ""},
+	{"lightstep", 1, "lightstep"},
+	{"otel_bridge", 1, "otel_bridge"},
+}
+
+// benchmarkTracers runs generate against each tracer variant. generate must
+// create spansPerOp spans for each of the b.N iterations. No satellite is
+// running, so reports fail and their errors are discarded.
+func benchmarkTracers(b *testing.B, spansPerOp int, generate func(tracer opentracing.Tracer)) {
+	*argNumTags = benchmarkTags
+	*argNumLogs = benchmarkLogs
+	*argDisableSystemMetrics = 1
+	setupAnnotations()
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(error) {}))
+
+	for _, variant := range tracerVariants {
+		b.Run(variant.name, func(b *testing.B) {
+			*argTrace = variant.trace
+			*argTracer = variant.tracer
+			tracer, closeTracer := buildTracer()
+			lightstep.SetGlobalEventHandler(func(lightstep.Event) {})
+			defer closeTracer(context.Background())
+
+			var before, after runtime.MemStats
+			b.ReportAllocs()
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				generate(tracer)
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+
+			spans := float64(b.N * spansPerOp)
+			b.ReportMetric(float64(spansPerOp), "spans/op")
+			b.ReportMetric(float64(after.Mallocs-before.Mallocs)/spans, "allocs/span")
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/spans, "B/span")
+		})
+	}
+}
+
+func BenchmarkMakeSpan(b *testing.B) {
+	benchmarkTracers(b, 1, func(tracer opentracing.Tracer) {
+		makeSpan(tracer, nil).Finish()
+	})
+}
+
+func BenchmarkGenerateSpans(b *testing.B) {
+	benchmarkTracers(b, spansPerLoop, func(tracer opentracing.Tracer) {
+		generateSpans(tracer, 0, spansPerLoop, nil)
+	})
+}
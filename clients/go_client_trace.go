@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+var argExecutionTrace = flag.String("execution_trace", "", "If set, write a Go execution trace to this file")
+var argExecutionTraceStart = flag.Duration("execution_trace_start", 0, "How long after span generation starts to begin the execution trace")
+var argExecutionTraceDuration = flag.Duration("execution_trace_duration", 0, "How long to record the execution trace for (0 records until the client exits)")
+
+// executionTrace records a runtime/trace for a window of the run.
+type executionTrace struct {
+	mutex   sync.Mutex
+	file    *os.File
+	running bool
+	stopped bool
+}
+
+// startExecutionTrace schedules the execution trace selected by the
+// --execution_trace flags and returns a function which stops it if it is
+// still running.
+func startExecutionTrace() func() {
+	if *argExecutionTrace == "" {
+		return func() {}
+	}
+	file, err := os.Create(*argExecutionTrace)
+	if err != nil {
+		log.Fatalf("unable to create execution trace: %v", err)
+	}
+	t := &executionTrace{file: file}
+	time.AfterFunc(*argExecutionTraceStart, func() {
+		t.start()
+		if *argExecutionTraceDuration > 0 {
+			time.AfterFunc(*argExecutionTraceDuration, t.stop)
+		}
+	})
+	return t.stop
+}
+
+func (t *executionTrace) start() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.stopped {
+		return
+	}
+	if err := trace.Start(t.file); err != nil {
+		log.Printf("unable to start execution trace: %v", err)
+		return
+	}
+	t.running = true
+}
+
+func (t *executionTrace) stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.stopped {
+		return
+	}
+	t.stopped = true
+	if t.running {
+		trace.Stop()
+		t.running = false
+	}
+	if err := t.file.Close(); err != nil {
+		log.Printf("unable to write execution trace: %v", err)
+	}
+}
+
+// startLoopTask marks one iteration of the span generation loop as a task in
+// the execution trace and returns a function which ends it. It does nothing
+// unless --execution_trace is set.
+func startLoopTask() (context.Context, func()) {
+	if *argExecutionTrace == "" {
+		return context.Background(), func() {}
+	}
+	ctx, task := trace.NewTask(context.Background(), "spanLoop")
+	return ctx, task.End
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"hash/maphash"
+	"log"
+	"sync"
+)
+
+var argDuplicateDetection = flag.String("duplicate_detection", "exact", "How to detect spans received more than once: exact, bloom or off")
+var argBloomCapacity = flag.Int("bloom_capacity", 10000000, "The number of spans the bloom filter is sized for with --duplicate_detection bloom")
+
+// With 16 bits per span and 11 hash functions, a bloom filter filled to
+// capacity mistakes about 0.05% of new spans for duplicates.
+const (
+	bloomBitsPerSpan = 16
+	bloomHashes      = 11
+)
+
+// spanKey identifies a span by its trace ID followed by its span ID.
+type spanKey [24]byte
+
+func makeSpanKey(trace traceID, span spanID) (key spanKey) {
+	copy(key[:16], trace[:])
+	copy(key[16:], span[:])
+	return key
+}
+
+// spanSet remembers span keys. add returns true if key was added before.
+type spanSet interface {
+	add(key spanKey) bool
+}
+
+type exactSet map[spanKey]struct{}
+
+func (s exactSet) add(key spanKey) bool {
+	if _, ok := s[key]; ok {
+		return true
+	}
+	s[key] = struct{}{}
+	return false
+}
+
+// bloomFilter is a compact spanSet which may mistake new keys for ones it
+// has seen, but never the other way around.
+type bloomFilter struct {
+	bits []uint64
+	hash maphash.Hash
+}
+
+func newBloomFilter(capacity int) *bloomFilter {
+	return &bloomFilter{bits: make([]uint64, (capacity*bloomBitsPerSpan+63)/64)}
+}
+
+func (f *bloomFilter) add(key spanKey) bool {
+	f.hash.Reset()
+	f.hash.Write(key[:])
+	sum := f.hash.Sum64()
+	// derives the hash functions from the two halves of one hash, as
+	// described by Kirsch and Mitzenmacher
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	size := uint64(len(f.bits)) * 64
+	seen := true
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % size
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.bits[word]&mask == 0 {
+			seen = false
+			f.bits[word] |= mask
+		}
+	}
+	return seen
+}
+
+// duplicateDetector counts received spans whose trace and span IDs it has
+// seen before, including in reports the satellite failed. A nil
+// *duplicateDetector detects nothing.
+type duplicateDetector struct {
+	newSet func() spanSet
+
+	mu   sync.Mutex
+	seen spanSet
+}
+
+// newDuplicateDetector returns a detector for the --duplicate_detection
+// mode, or nil if detection is off.
+func newDuplicateDetector(mode string, bloomCapacity int) *duplicateDetector {
+	var newSet func() spanSet
+	switch mode {
+	case "exact":
+		newSet = func() spanSet { return exactSet{} }
+	case "bloom":
+		newSet = func() spanSet { return newBloomFilter(bloomCapacity) }
+	case "off":
+		return nil
+	default:
+		log.Fatalf("unknown duplicate detection mode %q (exact, bloom or off)", mode)
+	}
+	return &duplicateDetector{newSet: newSet, seen: newSet()}
+}
+
+// reset forgets every span seen so far. The exact set grows with every span
+// received, so it's reset between tests to bound the satellite's memory.
+func (d *duplicateDetector) reset() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seen = d.newSet()
+}
+
+func (d *duplicateDetector) checkLightStepReport(report *collectorpb.ReportRequest) int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	duplicates := 0
+	for _, span := range report.Spans {
+		// meta event spans aren't counted in spans_received either
+		if span.SpanContext == nil || isMetaEvent(span) {
+			continue
+		}
+		key := makeSpanKey(lightStepTraceID(span.SpanContext.TraceId), lightStepSpanID(span.SpanContext.SpanId))
+		if d.seen.add(key) {
+			duplicates++
+		}
+	}
+	return duplicates
+}
+
+func (d *duplicateDetector) checkOTLPExport(request *coltracepb.ExportTraceServiceRequest) int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	duplicates := 0
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				key := makeSpanKey(otlpTraceID(span.TraceId), otlpSpanID(span.SpanId))
+				if d.seen.add(key) {
+					duplicates++
+				}
+			}
+		}
+	}
+	return duplicates
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestSpanSets(t *testing.T) {
+	sets := []struct {
+		name   string
+		newSet func() spanSet
+	}{
+		{name: "exact", newSet: func() spanSet { return exactSet{} }},
+		{name: "bloom", newSet: func() spanSet { return newBloomFilter(1000) }},
+	}
+	a := makeSpanKey(traceID{1}, spanID{1})
+	b := makeSpanKey(traceID{1}, spanID{2})
+	c := makeSpanKey(traceID{2}, spanID{1})
+	tests := []struct {
+		name string
+		keys []spanKey
+		want []bool
+	}{
+		{name: "new key", keys: []spanKey{a}, want: []bool{false}},
+		{name: "repeated key", keys: []spanKey{a, a, a}, want: []bool{false, true, true}},
+		{name: "distinct keys", keys: []spanKey{a, b, c}, want: []bool{false, false, false}},
+		{name: "repeated among distinct", keys: []spanKey{a, b, a, c, b}, want: []bool{false, false, true, false, true}},
+	}
+	for _, set := range sets {
+		for _, test := range tests {
+			t.Run(set.name+"/"+test.name, func(t *testing.T) {
+				s := set.newSet()
+				for i, key := range test.keys {
+					if seen := s.add(key); seen != test.want[i] {
+						t.Errorf("add #%d returned %t, want %t", i, seen, test.want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDuplicateDetectorReset(t *testing.T) {
+	for _, mode := range []string{"exact", "bloom"} {
+		t.Run(mode, func(t *testing.T) {
+			d := newDuplicateDetector(mode, 1000)
+			key := makeSpanKey(traceID{1}, spanID{1})
+			d.seen.add(key)
+			d.reset()
+			if d.seen.add(key) {
+				t.Error("span seen before reset is still seen")
+			}
+		})
+	}
+}
+
+func TestDuplicateDetectorOff(t *testing.T) {
+	d := newDuplicateDetector("off", 1000)
+	d.reset()
+	if duplicates := d.checkLightStepReport(nil); duplicates != 0 {
+		t.Errorf("detection off found %d duplicates", duplicates)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var argTimeline = flag.String("timeline", "", "A file of fault steps, like \"at 30s respond 503\", to run from when the satellite starts")
+
+// faults are injected into the handling of reports, over every transport.
+// The satellite's counters and admin endpoints are never faulted, so tests
+// can follow and steer it throughout.
+type faults struct {
+	// Mode overrides the satellite's mode if it isn't empty
+	Mode string
+	// Status is the HTTP error status reports fail with, or 0 if they don't
+	Status int
+	// Latency is added to every report's response time. Each "add" action
+	// adds to it until recovery.
+	Latency time.Duration
+	// Drop closes connections instead of responding to reports
+	Drop bool
+}
+
+// apply returns the faults after an action, which is one of:
+//
+//	respond STATUS
+//	add DURATION latency
+//	drop connections
+//	mode MODE
+//	recover
+func (f faults) apply(action string) (faults, error) {
+	words := strings.Fields(action)
+	switch {
+	case len(words) == 2 && words[0] == "respond":
+		status, err := strconv.Atoi(words[1])
+		if err != nil || status < 400 || status > 599 {
+			return f, fmt.Errorf("invalid status %q", words[1])
+		}
+		f.Status = status
+	case len(words) == 3 && words[0] == "add" && words[2] == "latency":
+		latency, err := time.ParseDuration(words[1])
+		if err != nil {
+			return f, err
+		}
+		f.Latency += latency
+	case len(words) == 2 && words[0] == "drop" && words[1] == "connections":
+		f.Drop = true
+	case len(words) == 2 && words[0] == "mode":
+		if _, ok := responseTimes[words[1]]; !ok {
+			return f, fmt.Errorf("unknown mode %q", words[1])
+		}
+		f.Mode = words[1]
+	case len(words) == 1 && words[0] == "recover":
+		f = faults{}
+	default:
+		return f, fmt.Errorf("unknown fault action %q", action)
+	}
+	return f, nil
+}
+
+// timelineStep applies action once the timeline has run for at.
+type timelineStep struct {
+	at     time.Duration
+	action string
+}
+
+// parseTimeline reads one "at DURATION ACTION" step per line. Blank lines
+// and lines starting with # are skipped.
+func parseTimeline(r io.Reader) ([]timelineStep, error) {
+	var steps []timelineStep
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		words := strings.Fields(text)
+		if len(words) < 3 || words[0] != "at" {
+			return nil, fmt.Errorf("line %d: expected \"at DURATION ACTION\"", line)
+		}
+		at, err := time.ParseDuration(words[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		action := strings.Join(words[2:], " ")
+		if _, err := (faults{}).apply(action); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		steps = append(steps, timelineStep{at: at, action: action})
+	}
+	return steps, scanner.Err()
+}
+
+// faultInjector holds the current faults and runs timelines which change
+// them.
+type faultInjector struct {
+	logger *log.Logger
+
+	mu     sync.Mutex
+	faults faults
+	// timers run the steps of the current timeline
+	timers []*time.Timer
+}
+
+func (i *faultInjector) current() faults {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.faults
+}
+
+func (i *faultInjector) apply(action string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f, err := i.faults.apply(action)
+	if err != nil {
+		return err
+	}
+	i.logger.Printf("Applying fault: %s", action)
+	i.faults = f
+	return nil
+}
+
+// runTimeline starts running steps from now, stopping the steps of the
+// previous timeline which haven't run yet.
+func (i *faultInjector) runTimeline(steps []timelineStep) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, timer := range i.timers {
+		timer.Stop()
+	}
+	i.timers = nil
+	for _, step := range steps {
+		action := step.action
+		i.timers = append(i.timers, time.AfterFunc(step.at, func() {
+			// steps were checked when the timeline was parsed
+			i.apply(action)
+		}))
+	}
+}
+
+func (i *faultInjector) loadTimeline(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	steps, err := parseTimeline(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	i.runTimeline(steps)
+	return nil
+}
+
+// serveAdmin handles GET /admin/fault, which describes the current faults,
+// POST /admin/fault, which applies the action in the body, and POST
+// /admin/timeline, which runs the timeline in the body from now.
+func (i *faultInjector) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/admin/fault":
+		f := i.current()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Mode":    f.Mode,
+			"Status":  f.Status,
+			"Latency": f.Latency.Seconds(),
+			"Drop":    f.Drop,
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/admin/fault":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := i.apply(string(body)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && r.URL.Path == "/admin/timeline":
+		steps, err := parseTimeline(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		i.logger.Printf("Running a timeline of %d fault steps", len(steps))
+		i.runTimeline(steps)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// grpcCode maps the HTTP status reports fail with to the gRPC status code
+// which gRPC reports fail with instead. Like slow_fail, 400 fails them with
+// InvalidArgument; the rest are mapped as gRPC clients map HTTP responses.
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"google.golang.org/grpc/codes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaultsApply(t *testing.T) {
+	latency := faults{Latency: time.Second}
+	tests := []struct {
+		name    string
+		before  faults
+		action  string
+		want    faults
+		wantErr bool
+	}{
+		{name: "respond", action: "respond 503", want: faults{Status: 503}},
+		{name: "respond keeps latency", before: latency, action: "respond 429", want: faults{Status: 429, Latency: time.Second}},
+		{name: "respond success", action: "respond 200", wantErr: true},
+		{name: "respond word", action: "respond often", wantErr: true},
+		{name: "add latency", action: "add 250ms latency", want: faults{Latency: 250 * time.Millisecond}},
+		{name: "add more latency", before: latency, action: "add 250ms latency", want: faults{Latency: 1250 * time.Millisecond}},
+		{name: "add bad latency", action: "add soon latency", wantErr: true},
+		{name: "drop connections", action: "drop connections", want: faults{Drop: true}},
+		{name: "mode", action: "mode slow_fail", want: faults{Mode: "slow_fail"}},
+		{name: "unknown mode", action: "mode fast", wantErr: true},
+		{name: "recover", before: faults{Status: 503, Latency: time.Second, Drop: true, Mode: "slow_succeed"}, action: "recover", want: faults{}},
+		{name: "extra spaces", action: "  respond   500 ", want: faults{Status: 500}},
+		{name: "unknown action", action: "explode", wantErr: true},
+		{name: "empty action", action: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := test.before.apply(test.action)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("apply(%q) succeeded, want an error", test.action)
+				}
+				if f != test.before {
+					t.Errorf("failed apply(%q) changed faults to %+v", test.action, f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply(%q) failed: %v", test.action, err)
+			}
+			if f != test.want {
+				t.Errorf("apply(%q) = %+v, want %+v", test.action, f, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeline string
+		want     []timelineStep
+		// the start of the error, if any
+		wantErr string
+	}{
+		{name: "empty", timeline: ""},
+		{
+			name:     "steps",
+			timeline: "at 30s respond 503\nat 1m recover\n",
+			want:     []timelineStep{{30 * time.Second, "respond 503"}, {time.Minute, "recover"}},
+		},
+		{
+			name:     "comments and blank lines",
+			timeline: "# outage\n\n  at 5s drop connections\n   \n# done\n",
+			want:     []timelineStep{{5 * time.Second, "drop connections"}},
+		},
+		{
+			name:     "action words rejoined",
+			timeline: "at 0s add  2s   latency",
+			want:     []timelineStep{{0, "add 2s latency"}},
+		},
+		{name: "missing at", timeline: "at 1s recover\n30s respond 503", wantErr: "line 2:"},
+		{name: "missing action", timeline: "at 1s", wantErr: "line 1:"},
+		{name: "bad duration", timeline: "# comment\nat soon recover", wantErr: "line 2:"},
+		{name: "bad action", timeline: "\nat 1s recover\nat 2s respond 200", wantErr: "line 3:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			steps, err := parseTimeline(strings.NewReader(test.timeline))
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Fatalf("parseTimeline returned error %v, want one starting %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimeline failed: %v", err)
+			}
+			if !reflect.DeepEqual(steps, test.want) {
+				t.Errorf("parseTimeline = %v, want %v", steps, test.want)
+			}
+		})
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   codes.Code
+	}{
+		{400, codes.InvalidArgument},
+		{401, codes.Unauthenticated},
+		{403, codes.PermissionDenied},
+		{404, codes.Unimplemented},
+		{429, codes.Unavailable},
+		{502, codes.Unavailable},
+		{503, codes.Unavailable},
+		{504, codes.Unavailable},
+		{500, codes.Unknown},
+		{418, codes.Unknown},
+	}
+	for _, test := range tests {
+		if code := grpcCode(test.status); code != test.want {
+			t.Errorf("grpcCode(%d) = %v, want %v", test.status, code, test.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Delivery latencies are counted in buckets which split each doubling of
+// microseconds 16 ways, so percentiles are accurate to within about 4.4%.
+// The Python mock satellite uses the same buckets, so that histograms from
+// both can be merged.
+const deliveryBucketsPerDoubling = 16
+
+// deliveryPercentiles are reported on /delivery_latency.
+var deliveryPercentiles = []struct {
+	name    string
+	percent float64
+}{{"P50", 50}, {"P90", 90}, {"P99", 99}, {"P99.9", 99.9}}
+
+// deliveryLatency records how long each span took to reach the satellite
+// after it finished, since it was last reset. Clients run on the same host,
+// so their clocks are the satellite's.
+type deliveryLatency struct {
+	mu     sync.Mutex
+	counts map[int]int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func newDeliveryLatency() *deliveryLatency {
+	return &deliveryLatency{counts: map[int]int64{}}
+}
+
+// deliveryBucket returns the bucket counting latency d, whose upper bound is
+// deliveryBucketBound(bucket).
+func deliveryBucket(d time.Duration) int {
+	micros := float64(d) / float64(time.Microsecond)
+	if micros <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(micros) * deliveryBucketsPerDoubling))
+}
+
+func deliveryBucketBound(bucket int) time.Duration {
+	return time.Duration(math.Exp2(float64(bucket)/deliveryBucketsPerDoubling) * float64(time.Microsecond))
+}
+
+func (l *deliveryLatency) recordLightStepReport(report *collectorpb.ReportRequest, received time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, span := range report.Spans {
+		if span.StartTimestamp == nil || isMetaEvent(span) {
+			continue
+		}
+		start := time.Unix(span.StartTimestamp.Seconds, int64(span.StartTimestamp.Nanos))
+		l.record(received.Sub(start.Add(time.Duration(span.DurationMicros) * time.Microsecond)))
+	}
+}
+
+func (l *deliveryLatency) recordOTLPExport(request *coltracepb.ExportTraceServiceRequest, received time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				l.record(received.Sub(time.Unix(0, int64(span.EndTimeUnixNano))))
+			}
+		}
+	}
+}
+
+// record must be called with l.mu held. Spans which seem to have finished
+// after they were received, because their duration was rounded up, are
+// counted as delivered instantly.
+func (l *deliveryLatency) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	l.counts[deliveryBucket(d)]++
+	l.count++
+	l.sum += d
+	if d > l.max {
+		l.max = d
+	}
+}
+
+func (l *deliveryLatency) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts = map[int]int64{}
+	l.count = 0
+	l.sum = 0
+	l.max = 0
+}
+
+// writeSummary writes the latency percentiles and histogram in seconds. The
+// histogram lists the upper bound and count of each non-empty bucket.
+func (l *deliveryLatency) writeSummary(w http.ResponseWriter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buckets := make([]int, 0, len(l.counts))
+	for bucket := range l.counts {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	histogram := make([][2]float64, len(buckets))
+	for i, bucket := range buckets {
+		histogram[i] = [2]float64{deliveryBucketBound(bucket).Seconds(), float64(l.counts[bucket])}
+	}
+	summary := map[string]interface{}{
+		"Count":     l.count,
+		"Max":       l.max.Seconds(),
+		"Histogram": histogram,
+	}
+	if l.count > 0 {
+		summary["Mean"] = (l.sum / time.Duration(l.count)).Seconds()
+	} else {
+		summary["Mean"] = 0
+	}
+	for _, percentile := range deliveryPercentiles {
+		summary[percentile.name] = l.percentile(buckets, percentile.percent).Seconds()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// percentile returns the upper bound of the bucket holding the percent
+// percentile, capped at the largest latency recorded. buckets must be
+// sorted.
+func (l *deliveryLatency) percentile(buckets []int, percent float64) time.Duration {
+	rank := int64(math.Ceil(percent / 100 * float64(l.count)))
+	seen := int64(0)
+	for _, bucket := range buckets {
+		seen += l.counts[bucket]
+		if seen >= rank {
+			if bound := deliveryBucketBound(bucket); bound < l.max {
+				return bound
+			}
+			return l.max
+		}
+	}
+	return l.max
+}
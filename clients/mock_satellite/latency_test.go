@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDeliveryBucket(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		want    int
+	}{
+		{latency: 0, want: 0},
+		{latency: time.Microsecond, want: 0},
+		{latency: 2 * time.Microsecond, want: deliveryBucketsPerDoubling},
+		{latency: 2*time.Microsecond + time.Nanosecond, want: deliveryBucketsPerDoubling + 1},
+		{latency: 1024 * time.Microsecond, want: 10 * deliveryBucketsPerDoubling},
+	}
+	for _, test := range tests {
+		if bucket := deliveryBucket(test.latency); bucket != test.want {
+			t.Errorf("deliveryBucket(%v) = %d, want %d", test.latency, bucket, test.want)
+		}
+	}
+}
+
+// Each latency should fall within its bucket's bounds, which are at most
+// about 4.4% apart.
+func TestDeliveryBucketBounds(t *testing.T) {
+	latencies := []time.Duration{
+		1500 * time.Nanosecond,
+		37 * time.Microsecond,
+		time.Millisecond,
+		333 * time.Millisecond,
+		12 * time.Second,
+	}
+	for _, latency := range latencies {
+		bucket := deliveryBucket(latency)
+		lower, upper := deliveryBucketBound(bucket-1), deliveryBucketBound(bucket)
+		if latency <= lower || latency > upper {
+			t.Errorf("%v counted in bucket (%v, %v]", latency, lower, upper)
+		}
+		if float64(upper-lower)/float64(lower) > 0.045 {
+			t.Errorf("bucket of %v is (%v, %v], more than 4.5%% wide", latency, lower, upper)
+		}
+	}
+}
+
+func TestDeliveryPercentile(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies map[time.Duration]int
+		percent   float64
+		want      time.Duration
+	}{
+		{
+			name:    "no latencies",
+			percent: 50,
+			want:    0,
+		},
+		{
+			name:      "capped at max",
+			latencies: map[time.Duration]int{time.Millisecond + time.Nanosecond: 1},
+			percent:   50,
+			want:      time.Millisecond + time.Nanosecond,
+		},
+		{
+			name:      "bucket bound",
+			latencies: map[time.Duration]int{10 * time.Microsecond: 99, time.Second: 1},
+			percent:   50,
+			want:      deliveryBucketBound(deliveryBucket(10 * time.Microsecond)),
+		},
+		{
+			name:      "last rank in the lower bucket",
+			latencies: map[time.Duration]int{10 * time.Microsecond: 99, time.Second: 1},
+			percent:   99,
+			want:      deliveryBucketBound(deliveryBucket(10 * time.Microsecond)),
+		},
+		{
+			name:      "first rank in the upper bucket",
+			latencies: map[time.Duration]int{10 * time.Microsecond: 99, time.Second: 1},
+			percent:   99.9,
+			want:      time.Second,
+		},
+		{
+			name:      "negative latencies count as 0",
+			latencies: map[time.Duration]int{-time.Millisecond: 2},
+			percent:   50,
+			want:      0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newDeliveryLatency()
+			for latency, count := range test.latencies {
+				for i := 0; i < count; i++ {
+					l.record(latency)
+				}
+			}
+			buckets := make([]int, 0, len(l.counts))
+			for bucket := range l.counts {
+				buckets = append(buckets, bucket)
+			}
+			sort.Ints(buckets)
+			if percentile := l.percentile(buckets, test.percent); percentile != test.want {
+				t.Errorf("P%v = %v, want %v", test.percent, percentile, test.want)
+			}
+		})
+	}
+}
+
+func TestDeliveryLatencyReset(t *testing.T) {
+	l := newDeliveryLatency()
+	l.record(time.Millisecond)
+	l.reset()
+	if l.count != 0 || l.sum != 0 || l.max != 0 || len(l.counts) != 0 {
+		t.Errorf("latency not reset: count %d, sum %v, max %v, %d buckets", l.count, l.sum, l.max, len(l.counts))
+	}
+}
@@ -0,0 +1,310 @@
+// mock_satellite is a Go implementation of benchmark/mock_satellite.py. It
+// serves the same endpoints and modes, but is cheap enough to keep up with
+// clients reporting at high span rates. It also serves CollectorService.Report
+// and OTLP's TraceService.Export over gRPC on the same port.
+//
+// Usage: mock_satellite [--cert_file FILE --key_file FILE] [--validate ...] [--timeline FILE] PORT MODE
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tracers tag the spans they report for meta events with this key
+const metaEventKey = "lightstep.meta_event"
+
+// How long each mode takes to respond per span in a report. These match the
+// response times of the Python mock satellite.
+var responseTimes = map[string]time.Duration{
+	"typical":      50 * time.Nanosecond,
+	"slow_succeed": time.Microsecond,
+	"slow_fail":    10 * time.Nanosecond,
+}
+
+var argCertFile = flag.String("cert_file", "", "Serve TLS using this certificate")
+var argKeyFile = flag.String("key_file", "", "Private key for the --cert_file certificate")
+
+// satellite counts what it receives. The counters are updated atomically
+// because reports are handled concurrently.
+type satellite struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	mode       string
+	faults     *faultInjector
+	validator  *validator
+	duplicates *duplicateDetector
+	traces     *traceAssembler
+	latency    *deliveryLatency
+
+	spansReceived           int64
+	bytesReceived           int64
+	metaEventsReceived      int64
+	metricsRequestsReceived int64
+	duplicateSpans          int64
+
+	// spansReceived broken down by transport
+	httpSpansReceived int64
+	grpcSpansReceived int64
+}
+
+// countLightStepSpans returns the number of spans in a report and the number
+// of meta event spans, which are counted separately to keep spans_received
+// comparable.
+func countLightStepSpans(report *collectorpb.ReportRequest) (int, int) {
+	metaEvents := 0
+	for _, span := range report.Spans {
+		if isMetaEvent(span) {
+			metaEvents++
+		}
+	}
+	return len(report.Spans) - metaEvents, metaEvents
+}
+
+func isMetaEvent(span *collectorpb.Span) bool {
+	for _, tag := range span.Tags {
+		if tag.Key == metaEventKey {
+			return true
+		}
+	}
+	return false
+}
+
+func countOTLPSpans(request *coltracepb.ExportTraceServiceRequest) int {
+	spans := 0
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			spans += len(scopeSpans.Spans)
+		}
+	}
+	return spans
+}
+
+func (s *satellite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/spans_received":
+		writeCount(w, &s.spansReceived)
+	case r.Method == http.MethodGet && r.URL.Path == "/spans_received_by_transport":
+		s.writeSpansByTransport(w)
+	case r.Method == http.MethodGet && r.URL.Path == "/validation":
+		s.validator.writeReport(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/validation/reset":
+		s.validator.reset()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && r.URL.Path == "/traces":
+		s.traces.writeSummary(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/traces/reset":
+		s.traces.reset()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && r.URL.Path == "/delivery_latency":
+		s.latency.writeSummary(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/delivery_latency/reset":
+		s.latency.reset()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && r.URL.Path == "/duplicate_spans":
+		writeCount(w, &s.duplicateSpans)
+	case r.Method == http.MethodPost && r.URL.Path == "/duplicate_spans/reset":
+		s.duplicates.reset()
+		atomic.StoreInt64(&s.duplicateSpans, 0)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && r.URL.Path == "/bytes_received":
+		writeCount(w, &s.bytesReceived)
+	case r.Method == http.MethodGet && r.URL.Path == "/meta_events_received":
+		writeCount(w, &s.metaEventsReceived)
+	case r.Method == http.MethodGet && r.URL.Path == "/metrics_requests_received":
+		writeCount(w, &s.metricsRequestsReceived)
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		s.faults.serveAdmin(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/reports":
+		s.handleLightStepReport(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/traces":
+		s.handleOTLPExport(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/metrics":
+		// system metrics ingest requests are accepted but not decoded
+		atomic.AddInt64(&s.metricsRequestsReceived, 1)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func writeCount(w http.ResponseWriter, count *int64) {
+	body := strconv.FormatInt(atomic.LoadInt64(count), 10)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	io.WriteString(w, body)
+}
+
+// writeSpansByTransport writes a JSON object mapping each transport to the
+// spans received over it.
+func (s *satellite) writeSpansByTransport(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{
+		transportHTTP: atomic.LoadInt64(&s.httpSpansReceived),
+		transportGRPC: atomic.LoadInt64(&s.grpcSpansReceived),
+	})
+}
+
+func (s *satellite) handleLightStepReport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	received := time.Now()
+	var report collectorpb.ReportRequest
+	if err := report.Unmarshal(body); err != nil {
+		// like real satellites, respond with a brief description of reports
+		// which can't be parsed
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	spans, metaEvents := countLightStepSpans(&report)
+	atomic.AddInt64(&s.duplicateSpans, int64(s.duplicates.checkLightStepReport(&report)))
+	if failure := s.process(spans); failure != 0 {
+		w.WriteHeader(failure)
+		return
+	}
+	s.count(transportHTTP, spans, metaEvents, len(body))
+	s.traces.addLightStepReport(&report)
+	s.latency.recordLightStepReport(&report, received)
+	s.validator.validateLightStepReport(&report)
+	response, _ := (&collectorpb.ReportResponse{}).Marshal()
+	w.Write(response)
+}
+
+func (s *satellite) handleOTLPExport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	received := time.Now()
+	var request coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	spans := countOTLPSpans(&request)
+	atomic.AddInt64(&s.duplicateSpans, int64(s.duplicates.checkOTLPExport(&request)))
+	if failure := s.process(spans); failure != 0 {
+		w.WriteHeader(failure)
+		return
+	}
+	s.count(transportHTTP, spans, 0, len(body))
+	s.traces.addOTLPExport(&request)
+	s.latency.recordOTLPExport(&request, received)
+	s.validator.validateOTLPExport(&request)
+	response, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(response)
+}
+
+// process waits as long as the mode takes to handle a report with this many
+// spans, plus any latency injected. It returns the HTTP status the report
+// fails with, or 0 if it succeeds.
+func (s *satellite) process(spans int) int {
+	f := s.faults.current()
+	mode := s.mode
+	if f.Mode != "" {
+		mode = f.Mode
+	}
+	time.Sleep(time.Duration(spans)*responseTimes[mode] + f.Latency)
+	if f.Status != 0 {
+		return f.Status
+	}
+	if mode == "slow_fail" {
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+func (s *satellite) count(transport string, spans int, metaEvents int, bytes int) {
+	atomic.AddInt64(&s.spansReceived, int64(spans))
+	if transport == transportGRPC {
+		atomic.AddInt64(&s.grpcSpansReceived, int64(spans))
+	} else {
+		atomic.AddInt64(&s.httpSpansReceived, int64(spans))
+	}
+	atomic.AddInt64(&s.metaEventsReceived, int64(metaEvents))
+	atomic.AddInt64(&s.bytesReceived, int64(bytes))
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] PORT MODE\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	port, err := strconv.Atoi(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("invalid port %q", flag.Arg(0))
+	}
+	mode := flag.Arg(1)
+	if _, ok := responseTimes[mode]; !ok {
+		log.Fatalf("unknown mode %q (typical, slow_succeed or slow_fail)", mode)
+	}
+
+	// log to stdout so that the controller can differentiate between errors
+	// (written to stderr) and logs (written to stdout)
+	logger := log.New(os.Stdout, "", 0)
+	logger.Printf("Running satellite on port %d in %s mode", port, mode)
+
+	s := &satellite{
+		mode:       mode,
+		faults:     &faultInjector{logger: logger},
+		duplicates: newDuplicateDetector(*argDuplicateDetection, *argBloomCapacity),
+		traces:     newTraceAssembler(*argSpansPerTrace),
+		latency:    newDeliveryLatency(),
+	}
+	if *argTimeline != "" {
+		logger.Printf("Running fault timeline %s", *argTimeline)
+		if err := s.faults.loadTimeline(*argTimeline); err != nil {
+			log.Fatalf("unable to load timeline: %v", err)
+		}
+	}
+	if *argValidate {
+		logger.Printf("Validating spans with %d tags and %d logs", *argNumTags, *argNumLogs)
+		s.validator = newValidator(*argNumTags, *argNumLogs, *argOperationName)
+	}
+	grpcServer := grpc.NewServer(grpc.StatsHandler(wireBytesHandler{}))
+	collectorpb.RegisterCollectorServiceServer(grpcServer, s)
+	coltracepb.RegisterTraceServiceServer(grpcServer, s)
+	server := &http.Server{Handler: &transportHandler{grpcServer: grpcServer, satellite: s}}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *argCertFile != "" {
+		logger.Printf("Serving TLS with certificate %s", *argCertFile)
+		cert, err := tls.LoadX509KeyPair(*argCertFile, *argKeyFile)
+		if err != nil {
+			log.Fatalf("unable to load certificate: %v", err)
+		}
+		listener = tls.NewListener(listener, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{http2.NextProtoTLS, "http/1.1"},
+		})
+	}
+	log.Fatal(serveTransports(listener, server))
+}
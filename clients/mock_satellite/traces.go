@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"net/http"
+	"sync"
+)
+
+var argSpansPerTrace = flag.Int("spans_per_trace", 0, "If set, traces must have this many spans to count as complete")
+
+// traceID and spanID hold OTLP IDs as is, and LightStep's 64-bit IDs in
+// their last 8 bytes.
+type traceID [16]byte
+type spanID [8]byte
+
+func lightStepTraceID(id uint64) (t traceID) {
+	binary.BigEndian.PutUint64(t[8:], id)
+	return t
+}
+
+func lightStepSpanID(id uint64) (s spanID) {
+	binary.BigEndian.PutUint64(s[:], id)
+	return s
+}
+
+func otlpTraceID(id []byte) (t traceID) {
+	copy(t[:], id)
+	return t
+}
+
+func otlpSpanID(id []byte) (s spanID) {
+	copy(s[:], id)
+	return s
+}
+
+// traceSummary is served on /traces.
+type traceSummary struct {
+	Traces            int
+	CompleteTraces    int
+	TracesMissingRoot int
+	// OrphanSpans counts spans whose parent never arrived
+	OrphanSpans int
+}
+
+// traceAssembler rebuilds the traces received since it was last reset from
+// the spans' contexts and references, so that drops can be judged by how
+// many traces stay usable.
+type traceAssembler struct {
+	spansPerTrace int
+
+	mu sync.Mutex
+	// traces maps each span of each trace to its parent, or to the zero
+	// spanID if it's a root span
+	traces map[traceID]map[spanID]spanID
+	// excluded holds the traces received before the last reset. Spans of
+	// these traces received since are ignored, since their trace would be
+	// missing the spans received before the reset.
+	excluded map[traceID]struct{}
+}
+
+func newTraceAssembler(spansPerTrace int) *traceAssembler {
+	return &traceAssembler{
+		spansPerTrace: spansPerTrace,
+		traces:        map[traceID]map[spanID]spanID{},
+		excluded:      map[traceID]struct{}{},
+	}
+}
+
+func (a *traceAssembler) addLightStepReport(report *collectorpb.ReportRequest) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, span := range report.Spans {
+		if span.SpanContext == nil || isMetaEvent(span) {
+			continue
+		}
+		var parent spanID
+		if len(span.References) > 0 && span.References[0].SpanContext != nil {
+			parent = lightStepSpanID(span.References[0].SpanContext.SpanId)
+		}
+		a.add(lightStepTraceID(span.SpanContext.TraceId), lightStepSpanID(span.SpanContext.SpanId), parent)
+	}
+}
+
+func (a *traceAssembler) addOTLPExport(request *coltracepb.ExportTraceServiceRequest) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				a.add(otlpTraceID(span.TraceId), otlpSpanID(span.SpanId), otlpSpanID(span.ParentSpanId))
+			}
+		}
+	}
+}
+
+// add must be called with a.mu held.
+func (a *traceAssembler) add(trace traceID, span spanID, parent spanID) {
+	if _, ok := a.excluded[trace]; ok {
+		return
+	}
+	spans, ok := a.traces[trace]
+	if !ok {
+		spans = map[spanID]spanID{}
+		a.traces[trace] = spans
+	}
+	spans[span] = parent
+}
+
+func (a *traceAssembler) summary() traceSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	summary := traceSummary{Traces: len(a.traces)}
+	for _, spans := range a.traces {
+		hasRoot := false
+		orphans := 0
+		for _, parent := range spans {
+			if parent == (spanID{}) {
+				hasRoot = true
+			} else if _, ok := spans[parent]; !ok {
+				orphans++
+			}
+		}
+		if !hasRoot {
+			summary.TracesMissingRoot++
+		}
+		summary.OrphanSpans += orphans
+		if hasRoot && orphans == 0 && (a.spansPerTrace == 0 || len(spans) == a.spansPerTrace) {
+			summary.CompleteTraces++
+		}
+	}
+	return summary
+}
+
+// reset forgets the traces received so far, and excludes them from the
+// traces received from now on.
+func (a *traceAssembler) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.excluded = make(map[traceID]struct{}, len(a.traces))
+	for trace := range a.traces {
+		a.excluded[trace] = struct{}{}
+	}
+	a.traces = map[traceID]map[spanID]spanID{}
+}
+
+func (a *traceAssembler) writeSummary(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.summary())
+}
@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+// testSpan is a span added to a traceAssembler in a test. resetBefore resets
+// the assembler before the span is added.
+type testSpan struct {
+	trace       byte
+	span        byte
+	parent      byte
+	resetBefore bool
+}
+
+func TestTraceAssemblerSummary(t *testing.T) {
+	tests := []struct {
+		name          string
+		spansPerTrace int
+		spans         []testSpan
+		want          traceSummary
+	}{
+		{
+			name: "no spans",
+			want: traceSummary{},
+		},
+		{
+			name:  "complete trace",
+			spans: []testSpan{{1, 1, 0, false}, {1, 2, 1, false}, {1, 3, 2, false}},
+			want:  traceSummary{Traces: 1, CompleteTraces: 1},
+		},
+		{
+			name:  "children before their root",
+			spans: []testSpan{{1, 3, 2, false}, {1, 2, 1, false}, {1, 1, 0, false}},
+			want:  traceSummary{Traces: 1, CompleteTraces: 1},
+		},
+		{
+			name:  "missing root",
+			spans: []testSpan{{1, 2, 1, false}, {1, 3, 2, false}},
+			want:  traceSummary{Traces: 1, TracesMissingRoot: 1, OrphanSpans: 1},
+		},
+		{
+			name:  "orphan span",
+			spans: []testSpan{{1, 1, 0, false}, {1, 3, 2, false}},
+			want:  traceSummary{Traces: 1, OrphanSpans: 1},
+		},
+		{
+			name:  "separate traces",
+			spans: []testSpan{{1, 1, 0, false}, {2, 1, 0, false}, {2, 2, 9, false}},
+			want:  traceSummary{Traces: 2, CompleteTraces: 1, OrphanSpans: 1},
+		},
+		{
+			name:          "too few spans per trace",
+			spansPerTrace: 3,
+			spans:         []testSpan{{1, 1, 0, false}, {1, 2, 1, false}, {2, 1, 0, false}, {2, 2, 1, false}, {2, 3, 2, false}},
+			want:          traceSummary{Traces: 2, CompleteTraces: 1},
+		},
+		{
+			name:  "reset forgets traces",
+			spans: []testSpan{{1, 1, 0, false}, {2, 1, 0, true}},
+			want:  traceSummary{Traces: 1, CompleteTraces: 1},
+		},
+		{
+			name:  "trace spanning a reset is ignored",
+			spans: []testSpan{{1, 1, 0, false}, {1, 2, 1, true}, {2, 1, 0, false}, {2, 2, 1, false}},
+			want:  traceSummary{Traces: 1, CompleteTraces: 1},
+		},
+		{
+			name:  "trace with its root after a reset is ignored",
+			spans: []testSpan{{1, 2, 1, false}, {1, 1, 0, true}},
+			want:  traceSummary{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTraceAssembler(test.spansPerTrace)
+			for _, span := range test.spans {
+				if span.resetBefore {
+					a.reset()
+				}
+				var parent spanID
+				if span.parent != 0 {
+					parent = spanID{span.parent}
+				}
+				a.add(traceID{span.trace}, spanID{span.span}, parent)
+			}
+			if got := a.summary(); got != test.want {
+				t.Errorf("summary() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	// decompresses reports sent with --grpc_gzip
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Spans received are broken down by the transport which delivered them.
+// OTLP/HTTP exports and HTTP reports sent over HTTP/2 count as "http".
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+)
+
+// Report implements collectorpb.CollectorServiceServer. gRPC reports are
+// counted, delayed and failed exactly like reports POSTed to /api/v2/reports.
+func (s *satellite) Report(ctx context.Context, report *collectorpb.ReportRequest) (*collectorpb.ReportResponse, error) {
+	received := time.Now()
+	spans, metaEvents := countLightStepSpans(report)
+	atomic.AddInt64(&s.duplicateSpans, int64(s.duplicates.checkLightStepReport(report)))
+	if failure := s.process(spans); failure != 0 {
+		return nil, status.Error(grpcCode(failure), http.StatusText(failure))
+	}
+	s.count(transportGRPC, spans, metaEvents, wireBytes(ctx))
+	s.traces.addLightStepReport(report)
+	s.latency.recordLightStepReport(report, received)
+	s.validator.validateLightStepReport(report)
+	return &collectorpb.ReportResponse{}, nil
+}
+
+// Export implements coltracepb.TraceServiceServer. OTLP/gRPC exports are
+// counted, delayed and failed exactly like exports POSTed to /v1/traces.
+func (s *satellite) Export(ctx context.Context, request *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	received := time.Now()
+	spans := countOTLPSpans(request)
+	atomic.AddInt64(&s.duplicateSpans, int64(s.duplicates.checkOTLPExport(request)))
+	if failure := s.process(spans); failure != 0 {
+		return nil, status.Error(grpcCode(failure), http.StatusText(failure))
+	}
+	s.count(transportGRPC, spans, 0, wireBytes(ctx))
+	s.traces.addOTLPExport(request)
+	s.latency.recordOTLPExport(request, received)
+	s.validator.validateOTLPExport(request)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// wireBytesKey keys the bytes a gRPC request took on the wire in its
+// context.
+type wireBytesKey struct{}
+
+// wireBytesHandler is a stats.Handler which records how many bytes each gRPC
+// request took on the wire, so that compressed reports count their
+// compressed size in bytes_received.
+type wireBytesHandler struct{}
+
+func (wireBytesHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, wireBytesKey{}, new(int64))
+}
+
+// HandleRPC is called with the request's InPayload before the request is
+// handled.
+func (wireBytesHandler) HandleRPC(ctx context.Context, rpcStats stats.RPCStats) {
+	payload, ok := rpcStats.(*stats.InPayload)
+	if !ok {
+		return
+	}
+	if bytes, ok := ctx.Value(wireBytesKey{}).(*int64); ok {
+		atomic.AddInt64(bytes, int64(payload.WireLength))
+	}
+}
+
+func (wireBytesHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (wireBytesHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// wireBytes returns how many bytes the request of the gRPC call with context
+// ctx took on the wire.
+func wireBytes(ctx context.Context) int {
+	if bytes, ok := ctx.Value(wireBytesKey{}).(*int64); ok {
+		return int(atomic.LoadInt64(bytes))
+	}
+	return 0
+}
+
+// transportHandler sends gRPC requests to the gRPC server and everything else
+// to the satellite's HTTP endpoints.
+type transportHandler struct {
+	grpcServer *grpc.Server
+	satellite  *satellite
+}
+
+func (h *transportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	isGRPC := r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+	isReport := isGRPC || r.URL.Path == "/api/v2/reports" || r.URL.Path == "/v1/traces"
+	if isReport && h.satellite.faults.current().Drop {
+		// closes the connection the report arrived on, failing every other
+		// request in flight on it, without responding
+		if conn, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+			conn.Close()
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if isGRPC {
+		h.grpcServer.ServeHTTP(w, r)
+		return
+	}
+	h.satellite.ServeHTTP(w, r)
+}
+
+// connKey keys the connection a request arrived on in its context, so that
+// the "drop connections" fault can close it.
+type connKey struct{}
+
+// sniffedConn is a connection whose first bytes have been peeked at to tell
+// which protocol the client speaks.
+type sniffedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// http1Listener hands the HTTP/1 connections accepted by serveTransports to
+// an http.Server.
+type http1Listener struct {
+	net.Listener
+	conns chan net.Conn
+	errs  chan error
+}
+
+func (l *http1Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	}
+}
+
+// isHTTP2 returns whether a connection starts with the HTTP/2 client preface.
+// It peeks no further than the first byte which differs from the preface, so
+// HTTP/1 requests shorter than the preface aren't left waiting for bytes the
+// client will never send.
+func isHTTP2(reader *bufio.Reader) bool {
+	for n := 1; n <= len(http2.ClientPreface); n++ {
+		peeked, err := reader.Peek(n)
+		if err != nil || peeked[n-1] != http2.ClientPreface[n-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// serveTransports serves HTTP/1, HTTP/2 and gRPC on one listener. There's
+// no h2c support vendored, so each connection's first bytes are compared
+// with the HTTP/2 client preface: HTTP/2 connections, which include all gRPC
+// connections, are served by an http2.Server and the rest by server. When
+// serving TLS, listener must already decrypt connections. Each request's
+// context holds its connection under connKey.
+func serveTransports(listener net.Listener, server *http.Server) error {
+	server.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		return context.WithValue(ctx, connKey{}, conn)
+	}
+	h1 := &http1Listener{
+		Listener: listener,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+	}
+	h2 := &http2.Server{}
+	go server.Serve(h1)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			h1.errs <- err
+			return err
+		}
+		go func() {
+			sniffed := &sniffedConn{Conn: conn, reader: bufio.NewReader(conn)}
+			if isHTTP2(sniffed.reader) {
+				h2.ServeConn(sniffed, &http2.ServeConnOpts{
+					Context:    context.WithValue(context.Background(), connKey{}, net.Conn(sniffed)),
+					BaseConfig: server,
+					Handler:    server.Handler,
+				})
+				return
+			}
+			h1.conns <- sniffed
+		}()
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsHTTP2(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"HTTP/2 preface", http2.ClientPreface, true},
+		{"HTTP/2 preface and frames", http2.ClientPreface + "\x00\x00\x00\x04", true},
+		{"short HTTP/1 request", "GET /a HTTP/1.0\r\n\r\n", false},
+		{"HTTP/1 POST", "POST /api/v2/reports HTTP/1.1\r\n", false},
+		{"HTTP/1 PUT", "PUT / HTTP/1.0\r\n\r\n", false},
+		{"preface with another version", "PRI * HTTP/1.1\r\n\r\n", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the client leaves the connection open, as HTTP/1 clients do
+			// while they wait for a response
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go client.Write([]byte(test.input))
+
+			result := make(chan bool, 1)
+			go func() { result <- isHTTP2(bufio.NewReader(server)) }()
+			select {
+			case got := <-result:
+				if got != test.want {
+					t.Errorf("isHTTP2(%q) = %v, want %v", test.input, got, test.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("isHTTP2(%q) blocked", test.input)
+			}
+		})
+	}
+}
+
+func sendHTTP1Report(conn net.Conn) error {
+	_, err := io.WriteString(conn, "POST /api/v2/reports HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n")
+	return err
+}
+
+func sendHTTP2Report(conn net.Conn) error {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		return err
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(); err != nil {
+		return err
+	}
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: "localhost"},
+		{Name: ":path", Value: "/api/v2/reports"},
+	} {
+		encoder.WriteField(field)
+	}
+	return framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+}
+
+// Dropped reports should close their connection over every protocol, not
+// just reset their HTTP/2 stream.
+func TestDropConnections(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(conn net.Conn) error
+	}{
+		{"HTTP/1", sendHTTP1Report},
+		{"HTTP/2", sendHTTP2Report},
+	}
+	s := &satellite{mode: "typical", faults: &faultInjector{logger: log.New(io.Discard, "", 0)}}
+	if err := s.faults.apply("drop connections"); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	server := &http.Server{
+		Handler:  &transportHandler{satellite: s},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	go serveTransports(listener, server)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if err := test.send(conn); err != nil {
+				t.Fatal(err)
+			}
+			// reads until the satellite closes the connection
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, err = io.Copy(io.Discard, conn)
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				t.Error("connection wasn't closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lightstep/lightstep-tracer-common/golang/gogo/collectorpb"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var argValidate = flag.Bool("validate", false, "Validate each span received against the workload's expectations and report problems on /validation")
+var argNumTags = flag.Int("num_tags", 0, "The number of tag.keyN tags clients set on each span")
+var argNumLogs = flag.Int("num_logs", 0, "The number of logs clients set on each span")
+var argOperationName = flag.String("operation_name", "", "The operation name clients give each span (any non-empty name if empty)")
+
+// The problems validation finds, as counted on /validation.
+const (
+	problemOperationName = "OperationName"
+	problemTagCount      = "TagCount"
+	problemTagKeys       = "TagKeys"
+	problemLogCount      = "LogCount"
+	problemDuration      = "Duration"
+	problemReferences    = "References"
+)
+
+var problems = []string{problemOperationName, problemTagCount, problemTagKeys, problemLogCount, problemDuration, problemReferences}
+
+// workloadTagPrefix starts the keys of the tags clients set on each span,
+// which are tag.key0 to tag.key<num_tags - 1>. Tags tracers add themselves
+// aren't validated.
+const workloadTagPrefix = "tag.key"
+
+// maxValidationExamples limits how many problems are described on
+// /validation.
+const maxValidationExamples = 10
+
+// receivedSpan is what validation checks in a LightStep or OTLP span. Root
+// spans have no parent.
+type receivedSpan struct {
+	traceID       string
+	spanID        string
+	hasParent     bool
+	parentTraceID string
+	parentSpanID  string
+	operationName string
+	duration      time.Duration
+	tagKeys       []string
+	logs          int
+}
+
+// validator checks received spans against --num_tags, --num_logs and
+// --operation_name. A nil *validator validates nothing.
+type validator struct {
+	numTags       int
+	numLogs       int
+	operationName string
+
+	mu             sync.Mutex
+	spansValidated int64
+	invalidSpans   int64
+	problems       map[string]int64
+	examples       []string
+	// roots maps each trace to its root span. Child spans whose references
+	// were lost show up as a second root in their trace.
+	roots map[string]string
+}
+
+func newValidator(numTags int, numLogs int, operationName string) *validator {
+	v := &validator{
+		numTags:       numTags,
+		numLogs:       numLogs,
+		operationName: operationName,
+	}
+	v.reset()
+	return v
+}
+
+// reset forgets the spans validated so far, including the root span of each
+// trace, so that the report only covers spans received from now on.
+func (v *validator) reset() {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.spansValidated = 0
+	v.invalidSpans = 0
+	v.problems = map[string]int64{}
+	for _, problem := range problems {
+		v.problems[problem] = 0
+	}
+	v.examples = []string{}
+	v.roots = map[string]string{}
+}
+
+func (v *validator) validateLightStepReport(report *collectorpb.ReportRequest) {
+	if v == nil {
+		return
+	}
+	for _, span := range report.Spans {
+		received := receivedSpan{
+			operationName: span.OperationName,
+			duration:      time.Duration(span.DurationMicros) * time.Microsecond,
+			logs:          len(span.Logs),
+		}
+		if span.SpanContext != nil {
+			received.traceID = formatLightStepID(span.SpanContext.TraceId)
+			received.spanID = formatLightStepID(span.SpanContext.SpanId)
+		}
+		if len(span.References) > 0 {
+			received.hasParent = true
+			if parent := span.References[0].SpanContext; parent != nil {
+				received.parentTraceID = formatLightStepID(parent.TraceId)
+				received.parentSpanID = formatLightStepID(parent.SpanId)
+			}
+		}
+		for _, tag := range span.Tags {
+			if strings.HasPrefix(tag.Key, workloadTagPrefix) {
+				received.tagKeys = append(received.tagKeys, tag.Key)
+			}
+		}
+		// meta event spans aren't part of the workload
+		if !isMetaEvent(span) {
+			v.validate(&received)
+		}
+	}
+}
+
+func formatLightStepID(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 16)
+}
+
+func (v *validator) validateOTLPExport(request *coltracepb.ExportTraceServiceRequest) {
+	if v == nil {
+		return
+	}
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				traceID := hex.EncodeToString(span.TraceId)
+				received := receivedSpan{
+					traceID:       traceID,
+					spanID:        hex.EncodeToString(span.SpanId),
+					operationName: span.Name,
+					logs:          len(span.Events),
+				}
+				// OTLP parents are always in the span's trace
+				if len(span.ParentSpanId) > 0 {
+					received.hasParent = true
+					received.parentSpanID = hex.EncodeToString(span.ParentSpanId)
+				}
+				if span.EndTimeUnixNano > span.StartTimeUnixNano {
+					received.duration = time.Duration(span.EndTimeUnixNano - span.StartTimeUnixNano)
+				}
+				for _, attribute := range span.Attributes {
+					if strings.HasPrefix(attribute.Key, workloadTagPrefix) {
+						received.tagKeys = append(received.tagKeys, attribute.Key)
+					}
+				}
+				v.validate(&received)
+			}
+		}
+	}
+}
+
+func (v *validator) validate(span *receivedSpan) {
+	var found []string
+	var details []string
+	fail := func(problem string, format string, args ...interface{}) {
+		found = append(found, problem)
+		details = append(details, fmt.Sprintf(format, args...))
+	}
+
+	if v.operationName != "" && span.operationName != v.operationName {
+		fail(problemOperationName, "operation name %q", span.operationName)
+	} else if span.operationName == "" {
+		fail(problemOperationName, "no operation name")
+	}
+	if len(span.tagKeys) != v.numTags {
+		fail(problemTagCount, "%d tags", len(span.tagKeys))
+	}
+	if missing := v.missingTagKeys(span.tagKeys); len(missing) > 0 {
+		fail(problemTagKeys, "missing tags %s", strings.Join(missing, ", "))
+	}
+	if span.logs != v.numLogs {
+		fail(problemLogCount, "%d logs", span.logs)
+	}
+	if span.duration <= 0 {
+		fail(problemDuration, "zero duration")
+	}
+	// LightStep tracers leave out the trace of references within the trace
+	if span.hasParent && (span.parentSpanID == "" || span.parentSpanID == span.spanID || (span.parentTraceID != "" && span.parentTraceID != span.traceID)) {
+		fail(problemReferences, "invalid reference to span %q in trace %q", span.parentSpanID, span.parentTraceID)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !span.hasParent {
+		if root, ok := v.roots[span.traceID]; ok && root != span.spanID {
+			fail(problemReferences, "second root span in trace %s", span.traceID)
+		} else {
+			v.roots[span.traceID] = span.spanID
+		}
+	}
+	v.spansValidated++
+	if len(found) == 0 {
+		return
+	}
+	v.invalidSpans++
+	for _, problem := range found {
+		v.problems[problem]++
+	}
+	if len(v.examples) < maxValidationExamples {
+		v.examples = append(v.examples, fmt.Sprintf("span %s: %s", span.spanID, strings.Join(details, "; ")))
+	}
+}
+
+// missingTagKeys returns the workload tag keys which aren't in keys.
+func (v *validator) missingTagKeys(keys []string) []string {
+	present := make([]bool, v.numTags)
+	for _, key := range keys {
+		if i, err := strconv.Atoi(strings.TrimPrefix(key, workloadTagPrefix)); err == nil && i >= 0 && i < v.numTags {
+			present[i] = true
+		}
+	}
+	var missing []string
+	for i, ok := range present {
+		if !ok {
+			missing = append(missing, workloadTagPrefix+strconv.Itoa(i))
+		}
+	}
+	return missing
+}
+
+// writeReport writes the validation report served on /validation.
+func (v *validator) writeReport(w http.ResponseWriter) {
+	report := map[string]interface{}{"Enabled": v != nil}
+	if v != nil {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		report["SpansValidated"] = v.spansValidated
+		report["InvalidSpans"] = v.invalidSpans
+		report["Problems"] = v.problems
+		report["Examples"] = v.examples
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
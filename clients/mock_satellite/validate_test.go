@@ -0,0 +1,170 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// validSpan returns a root span which passes validation by
+// newValidator(2, 1, "op").
+func validSpan(trace string, span string) receivedSpan {
+	return receivedSpan{
+		traceID:       trace,
+		spanID:        span,
+		operationName: "op",
+		duration:      time.Millisecond,
+		tagKeys:       []string{"tag.key0", "tag.key1"},
+		logs:          1,
+	}
+}
+
+func childSpan(trace string, span string, parent string) receivedSpan {
+	child := validSpan(trace, span)
+	child.hasParent = true
+	child.parentSpanID = parent
+	return child
+}
+
+func TestValidatorProblems(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans func() []receivedSpan
+		// the problem found, if any, in the last span
+		want string
+	}{
+		{
+			name:  "valid root",
+			spans: func() []receivedSpan { return []receivedSpan{validSpan("t", "a")} },
+		},
+		{
+			name:  "valid child",
+			spans: func() []receivedSpan { return []receivedSpan{validSpan("t", "a"), childSpan("t", "b", "a")} },
+		},
+		{
+			name: "wrong operation name",
+			spans: func() []receivedSpan {
+				span := validSpan("t", "a")
+				span.operationName = "other"
+				return []receivedSpan{span}
+			},
+			want: problemOperationName,
+		},
+		{
+			name: "extra tag",
+			spans: func() []receivedSpan {
+				span := validSpan("t", "a")
+				span.tagKeys = append(span.tagKeys, "tag.key2")
+				return []receivedSpan{span}
+			},
+			want: problemTagCount,
+		},
+		{
+			name: "duplicate tag",
+			spans: func() []receivedSpan {
+				span := validSpan("t", "a")
+				span.tagKeys = []string{"tag.key0", "tag.key0"}
+				return []receivedSpan{span}
+			},
+			want: problemTagKeys,
+		},
+		{
+			name: "missing log",
+			spans: func() []receivedSpan {
+				span := validSpan("t", "a")
+				span.logs = 0
+				return []receivedSpan{span}
+			},
+			want: problemLogCount,
+		},
+		{
+			name: "zero duration",
+			spans: func() []receivedSpan {
+				span := validSpan("t", "a")
+				span.duration = 0
+				return []receivedSpan{span}
+			},
+			want: problemDuration,
+		},
+		{
+			name:  "reference to itself",
+			spans: func() []receivedSpan { return []receivedSpan{childSpan("t", "a", "a")} },
+			want:  problemReferences,
+		},
+		{
+			name:  "reference without a span",
+			spans: func() []receivedSpan { return []receivedSpan{childSpan("t", "a", "")} },
+			want:  problemReferences,
+		},
+		{
+			name: "reference to another trace",
+			spans: func() []receivedSpan {
+				span := childSpan("t", "b", "a")
+				span.parentTraceID = "u"
+				return []receivedSpan{span}
+			},
+			want: problemReferences,
+		},
+		{
+			name:  "second root",
+			spans: func() []receivedSpan { return []receivedSpan{validSpan("t", "a"), validSpan("t", "b")} },
+			want:  problemReferences,
+		},
+		{
+			name:  "same root twice",
+			spans: func() []receivedSpan { return []receivedSpan{validSpan("t", "a"), validSpan("t", "a")} },
+		},
+		{
+			name:  "roots of separate traces",
+			spans: func() []receivedSpan { return []receivedSpan{validSpan("t", "a"), validSpan("u", "b")} },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := newValidator(2, 1, "op")
+			spans := test.spans()
+			for i := range spans {
+				v.validate(&spans[i])
+			}
+			if v.spansValidated != int64(len(spans)) {
+				t.Errorf("validated %d spans, want %d", v.spansValidated, len(spans))
+			}
+			for _, problem := range problems {
+				want := int64(0)
+				if problem == test.want {
+					want = 1
+				}
+				if v.problems[problem] != want {
+					t.Errorf("%d spans with problem %s, want %d", v.problems[problem], problem, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatorReset(t *testing.T) {
+	v := newValidator(2, 1, "op")
+	first := validSpan("t", "a")
+	v.validate(&first)
+	invalid := validSpan("t", "b")
+	v.validate(&invalid)
+	if v.invalidSpans != 1 || len(v.examples) != 1 {
+		t.Fatalf("%d invalid spans and %d examples before reset, want 1 and 1", v.invalidSpans, len(v.examples))
+	}
+
+	v.reset()
+	if v.spansValidated != 0 || v.invalidSpans != 0 || len(v.examples) != 0 || len(v.roots) != 0 {
+		t.Errorf("validator not reset: %d spans, %d invalid, %d examples, %d roots", v.spansValidated, v.invalidSpans, len(v.examples), len(v.roots))
+	}
+	// the trace's first root was forgotten
+	v.validate(&invalid)
+	if v.invalidSpans != 0 {
+		t.Errorf("%d invalid spans after reset, want 0", v.invalidSpans)
+	}
+}
+
+func TestNilValidator(t *testing.T) {
+	var v *validator
+	v.reset()
+	v.validateLightStepReport(nil)
+	v.validateOTLPExport(nil)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	satellitePort = 8360
+	spansPerLoop  = 6
+)
+
+var argTracer = flag.String("traceR", "", "Which OpenTelemetry tracer to use")
+var argTrace = flag.Int("trace", 0, "Whether to trace")
+var argSleep = flag.Float64("sleep", 0, "The amount of time to sleep for each span")
+var argSleepInterval = flag.Int("sleep_interval", 0, "The duration of each sleep")
+var argWork = flag.Int("work", 0, "The quanitity of work to perform between spans")
+var argRepeat = flag.Int("repeat", 0, "The number of span generation repetitions to perform")
+var argNoFlush = flag.Int("no_flush", 0, "Whether to flush on finishing")
+var argNumTags = flag.Int("num_tags", 0, "The number of tags to set on a span")
+var argNumLogs = flag.Int("num_logs", 0, "The number of logs to set on a span")
+var argCACertFile = flag.String("ca_cert_file", "", "If set, export over TLS and trust the CA certificate in this file")
+
+var workResult = 0.0
+var tagKeys []string = nil
+var tagVals []string = nil
+var logKeys []string = nil
+var logVals []string = nil
+
+func setupAnnotations() {
+	tagKeys = make([]string, *argNumTags)
+	tagVals = make([]string, *argNumTags)
+	logKeys = make([]string, *argNumLogs)
+	logVals = make([]string, *argNumLogs)
+	for i := 0; i < *argNumTags; i++ {
+		tagKeys[i] = fmt.Sprintf("tag.key%d", i)
+		tagVals[i] = fmt.Sprintf("tag.value%d", i)
+	}
+	for i := 0; i < *argNumLogs; i++ {
+		logKeys[i] = fmt.Sprintf("log.key%d", i)
+		logVals[i] = fmt.Sprintf("log.value%d", i)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func doWork(units int) {
+	// Follows the approach outlined in
+	// https://stackoverflow.com/a/36975497/4447365
+	// to prevent the compiler from optimizing out the result
+	x := 1.12563
+	for i := 0; i < units; i++ {
+		x *= math.Sqrt(math.Log(float64(i + 5)))
+	}
+	workResult = x
+}
+
+// buildTracer returns the tracer to benchmark along with a function that
+// flushes and shuts it down.
+func buildTracer() (trace.Tracer, func(context.Context) error) {
+	if *argTrace == 0 {
+		provider := trace.NewNoopTracerProvider()
+		return provider.Tracer(otelServiceName), func(context.Context) error { return nil }
+	}
+	provider, err := buildOTelTracerProvider()
+	if err != nil {
+		log.Fatalf("unable to build OpenTelemetry tracer: %v", err)
+	}
+	return provider.Tracer(otelServiceName), provider.Shutdown
+}
+
+// makeSpan mirrors makeSpan in go_client: tags become span attributes and
+// each log becomes a span event.
+func makeSpan(tracer trace.Tracer, parent context.Context) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(parent, "benchmark_test_service")
+	for i := 0; i < *argNumTags; i++ {
+		span.SetAttributes(attribute.String(tagKeys[i], tagVals[i]))
+	}
+	for i := 0; i < *argNumLogs; i++ {
+		span.AddEvent("log", trace.WithAttributes(attribute.String(logKeys[i], logVals[i])))
+	}
+	span.SetAttributes(attribute.String("trial", "alpha"))
+	return ctx, span
+}
+
+func generateSpans(tracer trace.Tracer, unitsWork int, numSpans int, parent context.Context) {
+	client_ctx, client_span := makeSpan(tracer, parent)
+	defer client_span.End()
+	doWork(unitsWork)
+	numSpans -= 1
+	if numSpans == 0 {
+		return
+	}
+
+	server_ctx, server_span := makeSpan(tracer, client_ctx)
+	defer server_span.End()
+	doWork(unitsWork)
+	numSpans -= 1
+	if numSpans == 0 {
+		return
+	}
+
+	_, db_span := makeSpan(tracer, server_ctx)
+	defer db_span.End()
+	doWork(unitsWork)
+	numSpans -= 1
+	if numSpans == 0 {
+		return
+	}
+
+	generateSpans(tracer, unitsWork, numSpans, server_ctx)
+}
+
+func performWork() {
+	tracer, shutdown := buildTracer()
+
+	sleepDebt := 0.0
+	spansSent := 0
+	for spansSent < *argRepeat {
+		spansToSend := min(*argRepeat-spansSent, spansPerLoop)
+		generateSpans(tracer, *argWork, spansToSend, context.Background())
+		spansSent += spansToSend
+		sleepDebt += *argSleep * float64(spansToSend)
+		if sleepDebt > float64(*argSleepInterval) {
+			sleepDebt -= float64(*argSleepInterval)
+			time.Sleep(time.Duration(*argSleepInterval) * time.Nanosecond)
+		}
+	}
+	if *argTrace != 0 && *argNoFlush != 1 {
+		if err := shutdown(context.Background()); err != nil {
+			log.Printf("error shutting down tracer: %v", err)
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	setupAnnotations()
+	performWork()
+}
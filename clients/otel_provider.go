@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc/credentials"
+	"os"
+	"time"
+)
+
+const (
+	otelServiceName = "go_benchmark_service"
+
+	// These values mirror the lightstep tracer configuration in go_client so
+	// that both tracers buffer and report on the same schedule
+	otelBatchTimeout = 2500 * time.Millisecond
+	otelMaxQueueSize = 1000
+)
+
+var argOTLPProtocol = flag.String("otlp_protocol", "http", "The OTLP transport to export spans over (http or grpc, which only the Go mock satellite serves)")
+
+// loadCACert returns a TLS configuration which trusts the --ca_cert_file CA,
+// or nil if spans are exported over plaintext.
+func loadCACert() (*tls.Config, error) {
+	if *argCACertFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(*argCACertFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", *argCACertFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+func buildOTLPExporter(ctx context.Context) (*otlptrace.Exporter, error) {
+	endpoint := fmt.Sprintf("localhost:%d", satellitePort)
+	tlsConfig, err := loadCACert()
+	if err != nil {
+		return nil, err
+	}
+	switch *argOTLPProtocol {
+	case "http":
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+		if tlsConfig != nil {
+			options = append(options, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		} else {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	case "grpc":
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+		if tlsConfig != nil {
+			options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		} else {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, options...)
+	}
+	return nil, fmt.Errorf("unknown OTLP protocol %q", *argOTLPProtocol)
+}
+
+// buildOTelTracerProvider returns an OpenTelemetry SDK tracer provider which
+// batches spans and exports them over OTLP to the mock satellite.
+func buildOTelTracerProvider() (*sdktrace.TracerProvider, error) {
+	exporter, err := buildOTLPExporter(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithBatchTimeout(otelBatchTimeout),
+			sdktrace.WithMaxQueueSize(otelMaxQueueSize),
+		),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(otelServiceName),
+		)),
+	), nil
+}
@@ -0,0 +1,88 @@
+import matplotlib.pyplot as plt
+from benchmark.controller import Controller
+from benchmark.satellite import MockSatelliteGroup as SatelliteGroup
+import numpy as np
+import argparse
+from os import path, makedirs
+from benchmark.utils import PROJECT_DIR
+
+GRAPHS_DIR = path.join(PROJECT_DIR, 'graphs')
+DATA_FILE = path.join(GRAPHS_DIR, 'raw_data_features.txt')
+
+# a rate of 1 span / sec leaves the tracer idle almost all of the time, so it
+# measures the per-second cost of background work
+SPS_LIST = [1, 100, 500, 1000, 2000]
+
+# tracer options for each configuration which is compared
+FEATURES = [
+    ('baseline', {
+        'MetaEventReporting': False,
+        'SystemMetricsDisabled': True}),
+    ('meta events', {
+        'MetaEventReporting': True,
+        'SystemMetricsDisabled': True}),
+    ('system metrics (1s)', {
+        'MetaEventReporting': False,
+        'SystemMetricsDisabled': False,
+        'SystemMetricsFrequency': 1}),
+]
+
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser(
+        description='Measure the CPU cost of tracer meta events and ' +
+                    'system metrics reporting.')
+    parser.add_argument(
+        'client',
+        help='Name of the client to use in these tests.')
+    parser.add_argument(
+        '--trials',
+        type=int,
+        default=3,
+        help='Number of trials to run at each span rate.')
+    parser.add_argument(
+        '--runtime',
+        type=int,
+        default=10,
+        help='Length of each trial.')
+    args = parser.parse_args()
+
+    makedirs(GRAPHS_DIR, exist_ok=True)
+
+    fig, ax = plt.subplots()
+
+    with SatelliteGroup('typical') as satellites:
+        with Controller(args.client) as controller:
+            for label, tracer_options in FEATURES:
+                cpu_list = []
+
+                for sps in SPS_LIST:
+                    cpu_list.append(np.mean([
+                        controller.benchmark(
+                            trace=True,
+                            satellites=satellites,
+                            spans_per_second=sps,
+                            runtime=args.runtime,
+                            no_timeout=True,
+                            tracer_options=tracer_options).cpu_usage * 100
+                        for i in range(args.trials)]))
+
+                print(f'{label}: CPU {cpu_list} at {SPS_LIST} spans / sec')
+
+                # save all raw data from test
+                with open(DATA_FILE, 'a+') as file:
+                    for i in range(len(SPS_LIST)):
+                        file.write(f'{label} {SPS_LIST[i]} {cpu_list[i]}\n')
+
+                ax.plot(SPS_LIST, cpu_list, label=label)
+
+            print('Meta event spans received: ' +
+                  f'{satellites.get_meta_events_received()}')
+            print('System metrics requests received: ' +
+                  f'{satellites.get_metrics_requests_received()}')
+
+    ax.set(xlabel="Spans per second", ylabel="Total CPU usage (percent)")
+    ax.set_title(
+        f'{controller.client_name.title()} Meta Event and System Metrics CPU')
+    ax.legend()
+    fig.savefig(path.join(
+        GRAPHS_DIR, f'{controller.client_name}_feature_cpu.png'))
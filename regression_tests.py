@@ -1,12 +1,13 @@
 import numpy as np
 import pytest
-from benchmark.controller import Controller
+from benchmark.controller import Controller, NUM_TAGS, NUM_LOGS
 from benchmark.satellite import MockSatelliteGroup as SatelliteGroup
 
 
 @pytest.fixture(scope='module')
 def satellites():
-    with SatelliteGroup('typical') as satellites:
+    validation = {'num_tags': NUM_TAGS, 'num_logs': NUM_LOGS}
+    with SatelliteGroup('typical', validation=validation) as satellites:
         yield satellites
 
 
@@ -51,6 +52,23 @@ def test_dropped_spans(client_name, satellites):
     assert(sps_300.dropped_spans == 0)
 
 
+def test_span_content(client_name, satellites):
+    """ Tracers shouldn't drop or corrupt the tags, logs or references of the
+    spans they report. Every span the satellites have received while running
+    these tests is validated. """
+
+    with Controller(client_name) as controller:
+        controller.benchmark(
+            trace=True,
+            spans_per_second=100,
+            runtime=5,
+            satellites=satellites)
+
+    validation = satellites.get_validation()
+    assert(validation['SpansValidated'] > 0)
+    assert validation['InvalidSpans'] == 0, validation['Examples']
+
+
 def test_cpu(client_name, satellites):
     """ Traced ciode shouldn't consume significatly more CPU than untraced
     code. Ensure that traced code sending 500 spans / second doesn't increase
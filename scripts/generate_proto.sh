@@ -11,3 +11,4 @@ BENCHMARK_DIR="$SCRIPT_DIR/../benchmark"
 # now compile proto files --> python files
 mkdir -p ${BENCHMARK_DIR}/generated
 protoc -I=${BENCHMARK_DIR}/${SRC_FOLDER} --python_out=${BENCHMARK_DIR}/${DST_FOLDER} ${BENCHMARK_DIR}/${SRC_FOLDER}/collector.proto
+protoc -I=${BENCHMARK_DIR}/${SRC_FOLDER} --python_out=${BENCHMARK_DIR}/${DST_FOLDER} ${BENCHMARK_DIR}/${SRC_FOLDER}/otlp_trace.proto
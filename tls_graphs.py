@@ -0,0 +1,91 @@
+import matplotlib.pyplot as plt
+from benchmark.controller import Controller, TRACER_OPTION_CLIENTS
+from benchmark.satellite import MockSatelliteGroup as SatelliteGroup
+import numpy as np
+import argparse
+from os import path, makedirs
+from benchmark.utils import PROJECT_DIR
+
+GRAPHS_DIR = path.join(PROJECT_DIR, 'graphs')
+DATA_FILE = path.join(GRAPHS_DIR, 'raw_data_tls.txt')
+
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser(
+        description='Compare tracer CPU use when reporting over TLS and ' +
+                    'over plaintext.')
+    parser.add_argument(
+        'client',
+        help='Name of the client to use in these tests.')
+    parser.add_argument(
+        '--trials',
+        type=int,
+        default=3,
+        help='Number of trials to run at each span rate.')
+    parser.add_argument(
+        '--runtime',
+        type=int,
+        default=10,
+        help='Length of each trial.')
+    parser.add_argument(
+        '--transport',
+        default='http',
+        choices=['http', 'grpc'],
+        help='Transport the client reports spans over, for clients which ' +
+             'accept tracer options. Only the Go mock satellites serve ' +
+             'gRPC, so they are used for grpc.')
+    args = parser.parse_args()
+
+    makedirs(GRAPHS_DIR, exist_ok=True)
+
+    sps_list = [100, 500, 1000, 2000, 5000]
+    tracer_options = {}
+    if args.client in TRACER_OPTION_CLIENTS:
+        tracer_options['Transport'] = args.transport
+    implementation = 'go' if args.transport == 'grpc' else 'python'
+    fig, ax = plt.subplots()
+
+    with Controller(args.client) as controller:
+        untraced_cpu = []
+        for sps in sps_list:
+            untraced_cpu.append(np.mean([
+                controller.benchmark(
+                    trace=False,
+                    spans_per_second=sps,
+                    runtime=args.runtime,
+                    no_timeout=True).cpu_usage * 100
+                for i in range(args.trials)]))
+
+        for label, tls in [('plaintext', False), ('TLS', True)]:
+            tracer_cpu = []
+
+            with SatelliteGroup('typical', tls=tls,
+                                implementation=implementation) as satellites:
+                for i, sps in enumerate(sps_list):
+                    traced_cpu = []
+                    for j in range(args.trials):
+                        result = controller.benchmark(
+                            trace=True,
+                            satellites=satellites,
+                            spans_per_second=sps,
+                            runtime=args.runtime,
+                            no_timeout=True,
+                            tracer_options=tracer_options)
+                        print(result)
+                        traced_cpu.append(result.cpu_usage * 100)
+
+                    tracer_cpu.append(np.mean(traced_cpu) - untraced_cpu[i])
+
+            # save all raw data from test
+            with open(DATA_FILE, 'a+') as file:
+                for i in range(len(sps_list)):
+                    file.write(f'{label} {sps_list[i]} {tracer_cpu[i]}\n')
+
+            ax.plot(sps_list, tracer_cpu, label=label)
+
+    ax.set(xlabel="Spans per second", ylabel="Tracer CPU usage (percent)")
+    ax.set_title(
+        f'{controller.client_name.title()} TLS vs Plaintext CPU Use ' +
+        f'({args.transport})')
+    ax.legend()
+    fig.savefig(path.join(
+        GRAPHS_DIR, f'{controller.client_name}_tls_vs_plaintext_cpu.png'))